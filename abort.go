@@ -0,0 +1,172 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
+)
+
+// An AbortError describes a request aborted with a status code, with an
+// optional message and cause.
+type AbortError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+func newAbortError(code int, causes ...interface{}) *AbortError {
+	ret := &AbortError{Code: code}
+	for _, c := range causes {
+		switch v := c.(type) {
+		case *AbortError:
+			ret.Message, ret.Err = v.Message, v.Err
+		case error:
+			ret.Err = v
+		case string:
+			ret.Message = v
+		case fmt.Stringer:
+			ret.Message = v.String()
+		}
+	}
+	if p, ok := problemOf(ret.Err); ok && ret.Code == 0 {
+		ret.Code = p.Status
+	}
+	if ret.Code == 0 {
+		ret.Code = http.StatusInternalServerError
+	}
+	return ret
+}
+
+// Text returns the message, or the status text of the code, safe to show to
+// clients.
+func (e *AbortError) Text() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return http.StatusText(e.Code)
+}
+
+func (e *AbortError) Error() string {
+	ret := strconv.Itoa(e.Code) + " " + e.Text()
+	if e.Err != nil {
+		ret += ": " + e.Err.Error()
+	}
+	return ret
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
+// A StatusHandler handles a request aborted with a status code.
+type StatusHandler func(state.State, *AbortError)
+
+func statusHandlerName(code int) string {
+	return "status_handler_" + strconv.Itoa(code)
+}
+
+// HandleStatus returns a Config registering the StatusHandler for requests
+// aborted with the status code under the blueprint prefix, or in the app
+// scope for an empty or "/" prefix, with the handler of the most specific
+// prefix used. A code of 0 registers a handler for any status code in the
+// scope, used when the scope has no handler for the specific code.
+func HandleStatus(prefix string, code int, h StatusHandler) Config {
+	return DefaultConfig(func(a *App) error {
+		x := extension.New(
+			"Status_Handler_"+prefix+"_"+strconv.Itoa(code),
+			mkFunction(statusHandlerName(code), func(s state.State, v interface{}) error {
+				if e, ok := v.(*AbortError); ok {
+					h(s, e)
+				}
+				return nil
+			}),
+		)
+		if prefix == "" || prefix == "/" {
+			a.Override(x)
+		} else {
+			a.NamespaceOverride(prefix, x)
+		}
+		return nil
+	})
+}
+
+type abortKey struct{}
+
+// abortFunc halts the remaining managers of the State, responding through the
+// StatusHandler registered for the status code and request scope, as problem
+// details when aborted with a Problem, or else the App status managers for
+// the code. A negative code halts without responding, and a code of 0 takes
+// the status of an aborting Problem, or else 500.
+func abortFunc(a *App) func(state.State, int, ...interface{}) error {
+	return func(s state.State, code int, causes ...interface{}) error {
+		e := newAbortError(code, causes...)
+		if r := requestOf(s.Request()); r != nil {
+			r.withValue(abortKey{}, e)
+		}
+		s.Bounce(func(ps state.State) {
+			if e.Code < 0 {
+				return
+			}
+			rw := ps.RWriter()
+			if !rw.Written() {
+				ps.SessionRelease(rw)
+			}
+			sc := scopeOf(a, ps.Request())
+			if d, ok := a.ScopedDispatcher(sc, statusHandlerName(e.Code), statusHandlerName(0)); ok {
+				d(ps, e)
+			} else if _, ok := problemOf(e.Err); ok {
+				ProblemJSON(true)(ps, e)
+			} else {
+				for _, m := range a.GetStatus(e.Code).Managers() {
+					m(ps)
+				}
+			}
+			if !rw.Written() {
+				rw.WriteHeader(e.Code)
+				rw.WriteHeaderNow()
+			}
+		})
+		return nil
+	}
+}
+
+// Provided a State, a status code, and optionally an error and/or message,
+// Abort halts the remaining managers of the State and responds with the
+// StatusHandler registered for the code.
+func Abort(s state.State, code int, causes ...interface{}) error {
+	_, err := Dispatch(s, "abort", append([]interface{}{code}, causes...)...)
+	return err
+}
+
+// Provided a State, Aborted returns the AbortError of an aborted request, or
+// nil, e.g. for status managers and templates.
+func Aborted(s state.State) *AbortError {
+	e, _ := Context(s).Value(abortKey{}).(*AbortError)
+	return e
+}
+
+// StatusJSON is a StatusHandler responding with the status code and text as
+// JSON.
+func StatusJSON(s state.State, e *AbortError) {
+	rw := s.RWriter()
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(e.Code)
+	rw.WriteHeaderNow()
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"status": e.Code,
+		"error":  e.Text(),
+	})
+}
+
+// StatusTemplate returns a StatusHandler rendering the named template with
+// the AbortError.
+func StatusTemplate(name string) StatusHandler {
+	return func(s state.State, e *AbortError) {
+		s.RWriter().WriteHeader(e.Code)
+		s.Call("render_template", name, e)
+	}
+}
@@ -0,0 +1,61 @@
+package app_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/app/extensions/response"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func TestAbort(t *testing.T) {
+	var aborted *app.AbortError
+	a := txst.TxstingApp(t, "abort",
+		app.HandleStatus("/api", 404, app.StatusJSON),
+		app.HandleStatus("/", 418, func(s state.State, e *app.AbortError) {
+			aborted = app.Aborted(s)
+			s.RWriter().WriteHeader(e.Code)
+		}),
+		mounted("/api", "/missing", func(s state.State) {
+			app.Abort(s, 404, "no such thing", errors.New("internal detail"))
+		}),
+	)
+	txst.MultiPerformer(t, a,
+		expect(404, "GET", "/api/missing", nil).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				var body map[string]interface{}
+				if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+					t.Fatalf("expected a JSON body, got %q: %s", rw.Body.String(), err)
+				}
+				if body["error"] != "no such thing" {
+					t.Errorf("expected a JSON response with the message, got %v", body)
+				}
+			}),
+		expect(418, "GET", "/teapot", func(s state.State) {
+			app.Abort(s, 418)
+		}).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+			if aborted == nil || aborted.Code != 418 {
+				t.Errorf("expected the app scope 418 handler, got %v", aborted)
+			}
+		}),
+	).Perform()
+}
+
+func TestResponseAbort(t *testing.T) {
+	rw := httptest.NewRecorder()
+	rq := httptest.NewRequest("GET", "/", nil)
+	s := state.New(response.Extension, nil, nil)
+	s.Reset(rq, rw, []state.Manage{func(s state.State) {
+		if _, err := s.Call("abort", 404, "no such thing"); err != nil {
+			t.Error(err)
+		}
+	}})
+	s.Run()
+	if rw.Code != 404 {
+		t.Errorf("standalone abort responded %d, expected 404", rw.Code)
+	}
+}
@@ -1,8 +1,11 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/flxtilla/cxre/blueprint"
 	"github.com/flxtilla/cxre/engine"
@@ -16,11 +19,22 @@ type App struct {
 	Configuration
 	Environment
 	blueprint.Blueprints
+	base    context.Context
+	stop    context.CancelFunc
+	mu      sync.Mutex
+	server  *http.Server
+	bundles []*Bundle
+	hooks   []func(context.Context, *App) error
+	// prefixes caches the blueprint prefix of each route, by method and
+	// pattern.
+	prefixes sync.Map
 }
 
 // Empty returns an App instance with the provided name.
 func Empty(name string) *App {
-	return &App{name: name}
+	a := &App{name: name}
+	a.base, a.stop = context.WithCancel(context.Background())
+	return a
 }
 
 // Base returns an intialized App with crucial and the provided
@@ -51,7 +65,11 @@ func (a *App) Name() string {
 
 // ServeHTTP function for the App
 func (a *App) ServeHTTP(rw http.ResponseWriter, rq *http.Request) {
-	a.Engine.ServeHTTP(rw, rq)
+	aw := &accessWriter{ResponseWriter: rw}
+	rq, finish := beginRequest(a, aw, rq)
+	defer logAccess(a, aw, rq, time.Now())
+	defer finish()
+	a.Engine.ServeHTTP(aw, rq)
 }
 
 // Run checks the App is configured, configuring and panicing on errors, then
@@ -62,7 +80,60 @@ func (a *App) Run(addr string) {
 			a.Panic(fmt.Sprintf("[FLOTILLA] app could not be configured properly:\n%s", err))
 		}
 	}
-	if err := http.ListenAndServe(addr, a); err != nil {
+	a.mu.Lock()
+	a.server = &http.Server{Addr: addr, Handler: a}
+	srv := a.server
+	a.mu.Unlock()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		a.Panic(err)
 	}
 }
+
+// Shutdown cancels the context.Context of all outstanding requests, with
+// requests begun afterwards, e.g. while the server drains, not cancelled, then
+// gracefully shuts down any server started by Run, waiting until the server
+// is idle or the provided context is done, and finally runs the shutdown
+// hooks of any installed Bundles and those registered with OnShutdown.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	stop := a.stop
+	a.base, a.stop = context.WithCancel(context.Background())
+	srv := a.server
+	a.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+	if berr := shutdownBundles(ctx, a); err == nil {
+		err = berr
+	}
+	a.mu.Lock()
+	hooks := a.hooks
+	a.hooks = nil
+	a.mu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if herr := hooks[i](ctx, a); err == nil {
+			err = herr
+		}
+	}
+	return err
+}
+
+// baseContext returns the context.Context cancelling the requests begun
+// before the next Shutdown.
+func (a *App) baseContext() context.Context {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.base
+}
+
+// OnShutdown registers a hook run by Shutdown after the shutdown hooks of any
+// Bundles, with hooks run in reverse order of registration.
+func (a *App) OnShutdown(fn func(context.Context, *App) error) {
+	a.mu.Lock()
+	a.hooks = append(a.hooks, fn)
+	a.mu.Unlock()
+}
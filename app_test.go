@@ -1,12 +1,104 @@
 package app_test
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/extension"
 	"github.com/flxtilla/cxre/state"
 	"github.com/flxtilla/txst"
 )
 
+// expectation is a txst.Expectation sending additional request headers,
+// optionally to a target other than the route path, and making additional
+// checks of the response. A nil state.Manage registers no route, for routes
+// registered by a Config.
+type expectation struct {
+	txst.Expectation
+	manage  state.Manage
+	headers []string
+	target  string
+	ctx     context.Context
+	body    []byte
+	checks  []func(*testing.T, *httptest.ResponseRecorder)
+}
+
+func expect(code int, method, path string, m state.Manage, headers ...string) *expectation {
+	x, _ := txst.NewExpectation(code, method, path, func(t *testing.T) state.Manage { return m })
+	return &expectation{Expectation: x, manage: m, headers: headers}
+}
+
+func (x *expectation) Register(t *testing.T, a *app.App) {
+	if x.manage != nil {
+		x.Expectation.Register(t, a)
+	}
+}
+
+func (x *expectation) check(fn func(*testing.T, *httptest.ResponseRecorder)) *expectation {
+	x.checks = append(x.checks, fn)
+	return x
+}
+
+// at sends the request to the target, e.g. for routes with parameters.
+func (x *expectation) at(target string) *expectation {
+	x.target = target
+	return x
+}
+
+// within sends the request with the context.Context, e.g. to disconnect.
+func (x *expectation) within(ctx context.Context) *expectation {
+	x.ctx = ctx
+	return x
+}
+
+// sending sends the body with the content type.
+func (x *expectation) sending(contentType string, body []byte) *expectation {
+	x.headers = append(x.headers, "Content-Type", contentType)
+	x.body = body
+	return x
+}
+
+func (x *expectation) Request() *http.Request {
+	rq := x.Expectation.Request()
+	if x.body != nil {
+		rq.Body = io.NopCloser(bytes.NewReader(x.body))
+		rq.ContentLength = int64(len(x.body))
+	}
+	if x.ctx != nil {
+		rq = rq.WithContext(x.ctx)
+	}
+	if x.target != "" {
+		rq.URL, _ = url.Parse(x.target)
+	}
+	for i := 0; i+1 < len(x.headers); i += 2 {
+		rq.Header.Set(x.headers[i], x.headers[i+1])
+	}
+	return rq
+}
+
+func (x *expectation) Response(t *testing.T, rw *httptest.ResponseRecorder) {
+	x.Expectation.Response(t, rw)
+	for _, fn := range x.checks {
+		fn(t, rw)
+	}
+}
+
+// mounted returns a Config adding a blueprint at the prefix, routing GET
+// requests for the path to the state.Manage, for expectations of blueprint
+// routes.
+func mounted(prefix, path string, m state.Manage) app.Config {
+	return app.DefaultConfig(func(a *app.App) error {
+		a.NewBlueprint(prefix).GET(path, m)
+		return nil
+	})
+}
+
 //func AppForTest(t *testing.T, name string, conf ...Config) *App {
 //	conf = append(conf, Mode("Testing", true))
 //	a := New(name, conf...)
@@ -119,3 +211,35 @@ func TestRouteNotOK(t *testing.T) {
 		testRouteNotOK(m, t)
 	}
 }
+
+func TestTyped(t *testing.T) {
+	a := txst.TxstingApp(t, "typed")
+	modeIs := app.Typed[func(state.State, string) bool]("mode_is")
+	if err := modeIs.Resolve(a); err != nil {
+		t.Errorf("mode_is could not be resolved: %s", err)
+	}
+	if modeIs.Fn() == nil {
+		t.Error("resolved mode_is was nil")
+	}
+	mistyped := app.Typed[func(state.State) bool]("mode_is")
+	if err := mistyped.Resolve(a); err == nil {
+		t.Error("mistyped mode_is resolved without error")
+	}
+	missing := app.Typed[func(state.State)]("not_an_extension_function")
+	if err := missing.Resolve(a); err == nil {
+		t.Error("missing extension function resolved without error")
+	}
+}
+
+func TestBuiltInTypes(t *testing.T) {
+	a := txst.TxstingApp(t, "built_in_types")
+	if err := app.BuiltIns.Resolve(a); err != nil {
+		t.Errorf("built in extension functions were mistyped: %s", err)
+	}
+	a.Override(extension.New("mistyped_mode", extension.NewFunction("mode_is", func(state.State, string) string {
+		return "yes"
+	})))
+	if err := app.BuiltIns.Resolve(a); err == nil {
+		t.Error("a mistyped mode_is resolved without error")
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"mime/multipart"
+
+	"github.com/flxtilla/app/extensions/bind"
+	"github.com/flxtilla/cxre/state"
+)
+
+// bindFunc binds with a bind.Binder limiting bodies by the "upload_size"
+// Store value, binding uploads parsed once per request and the route
+// parameters of the request.
+func bindFunc(a *App) func(state.State, interface{}) error {
+	b := bind.Binder{
+		Limit: func(state.State) int64 {
+			return storedSize(a, "upload_size", 10000000)
+		},
+		Uploads: func(s state.State) (*multipart.Form, error) {
+			return uploads(a, s)
+		},
+		Params: func(s state.State) map[string][]string {
+			if r := requestOf(s.Request()); r != nil {
+				return r.params()
+			}
+			return nil
+		},
+	}
+	return b.Bind
+}
+
+func validateFunc(s state.State, v interface{}) error {
+	return bind.Validate(v)
+}
+
+// Provided a State and a pointer to a tagged struct, Bind binds the request
+// query, body, uploaded files, and route parameters into the struct and
+// validates it, returning any bind.FieldErrors, or any other error decoding
+// the request.
+func Bind(s state.State, dst interface{}) error {
+	_, err := Dispatch(s, "bind", dst)
+	return err
+}
+
+// Provided a State and a pointer to a tagged struct, Validate validates the
+// struct, returning any bind.FieldErrors.
+func Validate(s state.State, v interface{}) error {
+	_, err := Dispatch(s, "validate", v)
+	return err
+}
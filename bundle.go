@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+
+	"github.com/flxtilla/cxre/asset"
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// A Bundle is an app extension installed as a unit, contributing any number
+// of Configs(e.g. for routes and blueprints, applied by Order with the App
+// Configs), extension functions, Store defaults, Assets for templates and
+// static files, and shutdown hooks. A Bundle may require other Bundles, by
+// name, to be installed before it.
+type Bundle struct {
+	Name       string
+	Requires   []string
+	Configs    []Config
+	Extensions []extension.Extension
+	Store      map[string]string
+	Assets     []asset.AssetFS
+	Shutdown   []func(context.Context, *App) error
+}
+
+var (
+	duplicateBundle = xrr.NewXrror("bundle %s is already installed").Out
+	missingBundle   = xrr.NewXrror("bundle %s requires bundle %s, which is not installed").Out
+	cyclicBundle    = xrr.NewXrror("bundle %s has a cyclic requirement").Out
+)
+
+// Install adds the provided Bundles to the App, to be set up in order of
+// requirement when the App is configured.
+func (a *App) Install(bs ...*Bundle) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, b := range bs {
+		for _, i := range a.bundles {
+			if i.Name == b.Name {
+				return duplicateBundle(b.Name)
+			}
+		}
+		a.bundles = append(a.bundles, b)
+	}
+	return nil
+}
+
+// Bundles returns a Config installing the provided Bundles.
+func Bundles(bs ...*Bundle) Config {
+	return NewConfig(4, func(a *App) error {
+		return a.Install(bs...)
+	})
+}
+
+// sortBundles returns the provided bundles ordered so that every Bundle comes
+// after the Bundles it requires.
+func sortBundles(bs []*Bundle) ([]*Bundle, error) {
+	named := make(map[string]*Bundle, len(bs))
+	for _, b := range bs {
+		named[b.Name] = b
+	}
+	var ret []*Bundle
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var visit func(*Bundle) error
+	visit = func(b *Bundle) error {
+		if done[b.Name] {
+			return nil
+		}
+		if visiting[b.Name] {
+			return cyclicBundle(b.Name)
+		}
+		visiting[b.Name] = true
+		for _, r := range b.Requires {
+			rb, ok := named[r]
+			if !ok {
+				return missingBundle(b.Name, r)
+			}
+			if err := visit(rb); err != nil {
+				return err
+			}
+		}
+		visiting[b.Name] = false
+		done[b.Name] = true
+		ret = append(ret, b)
+		return nil
+	}
+	for _, b := range bs {
+		if err := visit(b); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (b *Bundle) setUp(a *App) error {
+	for k, v := range b.Store {
+		if a.String(k) == "" {
+			a.Add(k, v)
+		}
+	}
+	if len(b.Assets) > 0 {
+		a.SetAssetFS(b.Assets...)
+	}
+	if err := a.ExtendChecked(b.Extensions...); err != nil {
+		return err
+	}
+	a.AddConfig(b.Configs...)
+	return nil
+}
+
+func cInstallBundles(a *App) error {
+	a.mu.Lock()
+	bs, err := sortBundles(a.bundles)
+	a.bundles = bs
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, b := range bs {
+		if err := b.setUp(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdownBundles runs the shutdown hooks of all installed Bundles, in reverse
+// order of installation, returning the first error encountered.
+func shutdownBundles(ctx context.Context, a *App) error {
+	a.mu.Lock()
+	bs := a.bundles
+	a.mu.Unlock()
+	var ret error
+	for i := len(bs) - 1; i >= 0; i-- {
+		for _, fn := range bs[i].Shutdown {
+			if err := fn(ctx, a); err != nil && ret == nil {
+				ret = err
+			}
+		}
+	}
+	return ret
+}
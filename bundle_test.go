@@ -0,0 +1,69 @@
+package app_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/txst"
+)
+
+func record(calls *[]string, name string) func(*app.App) error {
+	return func(*app.App) error {
+		*calls = append(*calls, name)
+		return nil
+	}
+}
+
+func TestBundles(t *testing.T) {
+	var configured, shutdown []string
+	bundle := func(name string, requires ...string) *app.Bundle {
+		return &app.Bundle{
+			Name:     name,
+			Requires: requires,
+			Configs: []app.Config{
+				app.NewConfig(40, record(&configured, name+" 40")),
+				app.NewConfig(60, record(&configured, name+" 60")),
+			},
+			Shutdown: []func(context.Context, *app.App) error{
+				func(context.Context, *app.App) error {
+					shutdown = append(shutdown, name)
+					return nil
+				},
+			},
+		}
+	}
+	a := txst.TxstingApp(t, "bundles",
+		app.Bundles(bundle("c", "b"), bundle("b", "a"), bundle("a")),
+		app.NewConfig(50, record(&configured, "app 50")),
+	)
+	expected := "a 40,b 40,c 40,app 50,a 60,b 60,c 60"
+	if got := strings.Join(configured, ","); got != expected {
+		t.Errorf("Configs were applied in order %q, expected %q", got, expected)
+	}
+	a.Shutdown(context.Background())
+	if got := strings.Join(shutdown, ","); got != "c,b,a" {
+		t.Errorf(`shutdown hooks ran in order %q, expected "c,b,a"`, got)
+	}
+}
+
+// TestBundleCycle configures an App with cyclic Bundles in a subprocess, as
+// configuration errors are fatal.
+func TestBundleCycle(t *testing.T) {
+	if os.Getenv("FLOTILLA_BUNDLE_CYCLE") == "1" {
+		txst.TxstingApp(t, "bundle_cycle", app.Bundles(
+			&app.Bundle{Name: "a", Requires: []string{"b"}},
+			&app.Bundle{Name: "b", Requires: []string{"a"}},
+		))
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestBundleCycle$")
+	cmd.Env = append(os.Environ(), "FLOTILLA_BUNDLE_CYCLE=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "cyclic requirement") {
+		t.Errorf("cyclic Bundles did not fail configuration: %s", out)
+	}
+}
@@ -0,0 +1,292 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flxtilla/cxre/engine"
+	"github.com/flxtilla/cxre/state"
+)
+
+// DefaultCompressTypes are the content types compressed when the Store has no
+// "compress_types".
+const DefaultCompressTypes = "text/*,application/json,application/javascript,application/xml,application/x-ndjson,application/problem+json,image/svg+xml"
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var encoders = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+// negotiateEncoding returns gzip or deflate, as preferred by an
+// Accept-Encoding header, preferring gzip, or an empty string for neither. A
+// "*" accepts only codings not listed otherwise, so never one refused with a
+// zero quality.
+func negotiateEncoding(header string) string {
+	qs := make(map[string]float64)
+	star := 0.0
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if coding == "*" {
+			star = q
+			continue
+		}
+		qs[coding] = q
+	}
+	var ret string
+	var best float64
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qs[coding]
+		if !ok {
+			q = star
+		}
+		if q > best {
+			ret, best = coding, q
+		}
+	}
+	return ret
+}
+
+type compressOptions struct {
+	min   int
+	types []string
+}
+
+func (o compressOptions) allowed(ct string) bool {
+	ct = strings.ToLower(strings.TrimSpace(strings.SplitN(ct, ";", 2)[0]))
+	if ct == "text/event-stream" {
+		return false
+	}
+	for _, t := range o.types {
+		switch {
+		case t == ct, t == "*/*":
+			return true
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(t, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter is an http.ResponseWriter compressing responses of an allowed
+// content type and at least a minimum size. The response header and body are
+// held back until enough is written to decide whether to compress. Responses
+// to HEAD requests are decided as for GET, by any Content-Length set when no
+// body is written.
+type compressWriter struct {
+	http.ResponseWriter
+	o        compressOptions
+	encoding string
+	head     bool
+	code     int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	enc      encoder
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if !c.decided && c.code == 0 {
+		c.code = code
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if len(c.buf) < c.o.min {
+			return len(b), nil
+		}
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.enc != nil {
+		return c.enc.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *compressWriter) compressible() bool {
+	h := c.Header()
+	switch {
+	case c.code == http.StatusNoContent, c.code == http.StatusNotModified,
+		c.code == http.StatusPartialContent, c.code > 0 && c.code < 200:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	case c.size() < c.o.min:
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(c.buf)
+		h.Set("Content-Type", ct)
+	}
+	return c.o.allowed(ct)
+}
+
+// size returns the size of the held back body, or for a HEAD request without
+// a body, of any Content-Length set.
+func (c *compressWriter) size() int {
+	if c.head && len(c.buf) == 0 {
+		if n, err := strconv.Atoi(c.Header().Get("Content-Length")); err == nil {
+			return n
+		}
+	}
+	return len(c.buf)
+}
+
+// decide writes the held back header, compressing the response when
+// compressible, and any held back body. A HEAD response without a body is
+// given the headers of a compressed response without compressing.
+func (c *compressWriter) decide() error {
+	c.decided = true
+	if c.compressible() {
+		h := c.Header()
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if !c.head || len(c.buf) > 0 {
+			c.enc = encoders[c.encoding].Get().(encoder)
+			c.enc.Reset(c.ResponseWriter)
+		}
+	}
+	if c.code != 0 {
+		c.ResponseWriter.WriteHeader(c.code)
+	}
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(buf)
+	} else {
+		_, err = c.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush writes any held back response, compressed as decided when enough has
+// been written, and flushes the compressor and the underlying writer.
+func (c *compressWriter) Flush() {
+	if c.hijacked {
+		return
+	}
+	if !c.decided && (len(c.buf) > 0 || c.code != 0) {
+		c.decide()
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	c.hijacked = true
+	return h.Hijack()
+}
+
+// close finishes the response, writing any held back response and closing
+// and returning any compressor to its pool.
+func (c *compressWriter) close() {
+	if c.hijacked {
+		return
+	}
+	if !c.decided && (len(c.buf) > 0 || c.code != 0) {
+		c.decide()
+	}
+	if c.enc != nil {
+		c.enc.Close()
+		c.enc.Reset(nil)
+		encoders[c.encoding].Put(c.enc)
+		c.enc = nil
+	}
+}
+
+func varyOn(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+func compressState(a *App) StateWrapFn {
+	return func(mk state.Make) state.Make {
+		return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
+			if _, ok := rw.(*compressWriter); ok {
+				return mk(rw, rq, rs, m)
+			}
+			varyOn(rw.Header(), "Accept-Encoding")
+			encoding := negotiateEncoding(rq.Header.Get("Accept-Encoding"))
+			r := requestOf(rq)
+			if encoding == "" || r == nil {
+				return mk(rw, rq, rs, m)
+			}
+			types := a.String("compress_types")
+			if types == "" {
+				types = DefaultCompressTypes
+			}
+			o := compressOptions{min: int(storedSize(a, "compress_min_size", 1024))}
+			for _, t := range strings.Split(types, ",") {
+				o.types = append(o.types, strings.ToLower(strings.TrimSpace(t)))
+			}
+			cw := &compressWriter{ResponseWriter: rw, o: o, encoding: encoding, head: rq.Method == http.MethodHead}
+			r.atFinish(cw.close)
+			return mk(cw, rq, rs, m)
+		}
+	}
+}
+
+// Compression returns a Config compressing responses with gzip or deflate, as
+// negotiated with the request Accept-Encoding, when the response content type
+// is allowed by the comma separated "compress_types" Store value(default
+// DefaultCompressTypes, with e.g. "text/*" allowing any text type), and the
+// response is at least the "compress_min_size" Store value in bytes(default
+// 1024). Responses already encoded, and partial responses to range requests,
+// are not compressed, and compressed responses do not accept ranges.
+func Compression() Config {
+	return DefaultConfig(func(a *App) error {
+		a.WrapStateFunctionOrdered(100, compressState(a))
+		return nil
+	})
+}
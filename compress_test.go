@@ -0,0 +1,117 @@
+package app_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+// encoded checks the response is encoded with the encoding, or not encoded
+// for an empty encoding.
+func encoded(encoding string) func(*testing.T, *httptest.ResponseRecorder) {
+	return func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if enc := rw.Header().Get("Content-Encoding"); enc != encoding {
+			t.Errorf("Content-Encoding was %q, expected %q", enc, encoding)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat("compressible ", 100)
+	a := txst.TxstingApp(t, "compression", app.Compression())
+	large := func(s state.State) { s.Call("serve_plain", 200, body) }
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/large", large, "Accept-Encoding", "deflate;q=0.5, gzip").
+			check(encoded("gzip")).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				if vary := rw.Header().Get("Vary"); vary != "Accept-Encoding" {
+					t.Errorf(`Vary was %q, expected "Accept-Encoding"`, vary)
+				}
+				zr, err := gzip.NewReader(rw.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if b, _ := io.ReadAll(zr); string(b) != body {
+					t.Errorf("decompressed body did not match the served body")
+				}
+			}),
+		expect(200, "GET", "/small", func(s state.State) { s.Call("serve_plain", 200, "small") }, "Accept-Encoding", "gzip").
+			check(encoded("")),
+		expect(200, "GET", "/refused", large, "Accept-Encoding", "gzip;q=0, *").
+			check(encoded("deflate")),
+		expect(200, "GET", "/identity", large, "Accept-Encoding", "gzip;q=0, deflate;q=0, *").
+			check(encoded("")),
+		expect(200, "GET", "/any", large, "Accept-Encoding", "*").
+			check(encoded("gzip")),
+	).Perform()
+}
+
+func TestCompressionRanges(t *testing.T) {
+	body := []byte(strings.Repeat("ranged ", 300))
+	a := txst.TxstingApp(t, "compression_ranges", app.Compression())
+	sends := func(s state.State) { app.SendFile(s, body, "ranged.txt") }
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/compressed", sends, "Accept-Encoding", "gzip").
+			check(encoded("gzip")).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				if ar := rw.Header().Get("Accept-Ranges"); ar != "" {
+					t.Errorf("compressed response had Accept-Ranges %q", ar)
+				}
+			}),
+		expect(200, "GET", "/uncompressed", sends).
+			check(encoded("")).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				if ar := rw.Header().Get("Accept-Ranges"); ar != "bytes" {
+					t.Errorf(`uncompressed response had Accept-Ranges %q, expected "bytes"`, ar)
+				}
+			}),
+		expect(206, "GET", "/partial", sends, "Accept-Encoding", "gzip", "Range", "bytes=0-5").
+			check(encoded("")),
+	).Perform()
+}
+
+func TestCompressionHead(t *testing.T) {
+	body := strings.Repeat("compressible ", 100)
+	a := txst.TxstingApp(t, "compression_head", app.Compression(), app.ETags(false))
+	plain := func(s state.State) { s.Call("serve_plain", 200, body) }
+	sends := func(s state.State) { app.SendFile(s, []byte(body), "sent.txt") }
+	var etag string
+	headers := func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if vary := rw.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf(`Vary was %q, expected "Accept-Encoding"`, vary)
+		}
+		if cl := rw.Header().Get("Content-Length"); cl != "" {
+			t.Errorf("compressed response had Content-Length %s", cl)
+		}
+	}
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/plain", plain, "Accept-Encoding", "gzip").
+			check(encoded("gzip")).
+			check(headers).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				etag = rw.Header().Get("ETag")
+			}),
+		expect(200, "HEAD", "/plain", plain, "Accept-Encoding", "gzip").
+			check(encoded("gzip")).
+			check(headers).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				if got := rw.Header().Get("ETag"); got == "" || got != etag {
+					t.Errorf("HEAD ETag was %q, expected the GET ETag %q", got, etag)
+				}
+			}),
+		expect(200, "HEAD", "/sent", sends, "Accept-Encoding", "gzip").
+			check(encoded("gzip")).
+			check(headers).
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				if ar := rw.Header().Get("Accept-Ranges"); ar != "" {
+					t.Errorf("compressed HEAD response had Accept-Ranges %q", ar)
+				}
+			}),
+	).Perform()
+}
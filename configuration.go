@@ -9,6 +9,7 @@ import (
 	"github.com/flxtilla/cxre/blueprint"
 	"github.com/flxtilla/cxre/engine"
 	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
 )
 
 type ConfigFn func(*App) error
@@ -101,13 +102,31 @@ func respondTo(c *configuration, err error) {
 	}
 }
 
-func (c *configuration) Configure() error {
-	sort.Sort(c.list)
+// run applies the Configs in order, with any Configs added while configuring,
+// e.g. those of Bundles, merged by order into the Configs remaining.
+func (c *configuration) run() error {
+	sort.Stable(c.list)
+	for i, n := 0, len(c.list); i < len(c.list); i++ {
+		if len(c.list) != n {
+			sort.Stable(c.list[i:])
+			n = len(c.list)
+		}
+		if err := c.list[i].Configure(c.a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	err := configure(c.a, c.list...)
+func (c *configuration) Configure() error {
+	err := c.run()
+	if err != nil {
+		c.a.Subsystem("config").Errorf("configuration failed: %s", err)
+	}
 	respondTo(c, err)
 	if err == nil {
 		c.configured = true
+		c.a.Subsystem("config").Debugf("configured %s with %d Configs", c.a.Name(), len(c.list))
 	}
 
 	return err
@@ -139,16 +158,20 @@ func cEnsureEngine(a *App) error {
 
 func cEnsureBlueprints(a *App) error {
 	if a.Blueprints == nil {
-		a.Blueprints = blueprint.NewBlueprints("/", a.Handle, a.StateFunction(a))
+		a.Blueprints = blueprint.NewBlueprints("/", a.handle, a.StateFunction(a))
 	}
 	a.Handle("STATUS", "DEFAULT", a.StatusRule())
 	return nil
 }
 
 var builtIns = []Config{
+	config{5, cInstallBundles},
+	config{999, cLogLevels},
 	config{1000, cRegisterBlueprints},
 	config{1001, cSessionInit},
 	config{1002, cRegisterTemplateRender},
+	config{1098, cBuiltInTypes},
+	config{1099, cExtensionConflicts},
 }
 
 func cRegisterBlueprints(a *App) error {
@@ -161,20 +184,41 @@ func cRegisterBlueprints(a *App) error {
 }
 
 func cSessionInit(a *App) error {
+	if err := checkSessionPolicy(a.String("session_failure")); err != nil {
+		return err
+	}
 	a.Init()
 	return nil
 }
 
+const templateRenderExtension = "template_render_extension"
+
 func cRegisterTemplateRender(a *App) error {
 	a.SetTemplateFunctions()
 	ext := extension.New(
-		"template_render_extension",
-		mkFunction("render_template", a.RenderTemplate),
+		templateRenderExtension,
+		mkFunction("render_template", renderTemplateFunc(a)),
 	)
 	a.Extend(ext)
 	return nil
 }
 
+// renderTemplateFunc renders templates, logging render errors to the
+// "templates" subsystem.
+func renderTemplateFunc(a *App) func(state.State, string, interface{}) error {
+	return func(s state.State, name string, data interface{}) error {
+		err := a.RenderTemplate(s, name, data)
+		if err != nil {
+			l := a.Subsystem("templates")
+			if r := requestOf(s.Request()); r != nil {
+				l = r.subsystem("templates")
+			}
+			l.Errorf("rendering template %s failed: %s", name, err)
+		}
+		return err
+	}
+}
+
 // Mode returns a ConfigurationFn for the mode and value, e.g. Mode("testing",
 // true).
 func Mode(mode string, value bool) Config {
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/flxtilla/cxre/log"
+	"github.com/flxtilla/cxre/session"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/store"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// A Dispatcher is a precompiled call of an extension function, taking State
+// and the extension function arguments.
+type Dispatcher func(state.State, ...interface{}) (interface{}, error)
+
+var badArguments = xrr.NewXrror("bad arguments for extension function: %v").Out
+
+func argAt[A any](args []interface{}, i int) (A, bool) {
+	var a A
+	if args[i] == nil {
+		return a, true
+	}
+	a, ok := args[i].(A)
+	return a, ok
+}
+
+// result returns the result of an extension function declared to return R,
+// as an error only when R is error, so that other results holding an error,
+// e.g. interface{}, are returned as values.
+func result[R any](v R) (interface{}, error) {
+	if _, ok := interface{}((*R)(nil)).(*error); ok {
+		err, _ := interface{}(v).(error)
+		return nil, err
+	}
+	return v, nil
+}
+
+func adapt0[R any](f func(state.State) R) Dispatcher {
+	return func(s state.State, args ...interface{}) (interface{}, error) {
+		if len(args) != 0 {
+			return nil, badArguments(args)
+		}
+		return result(f(s))
+	}
+}
+
+func adapt0E[R any](f func(state.State) (R, error)) Dispatcher {
+	return func(s state.State, args ...interface{}) (interface{}, error) {
+		if len(args) != 0 {
+			return nil, badArguments(args)
+		}
+		return f(s)
+	}
+}
+
+func adapt1[A, R any](f func(state.State, A) R) Dispatcher {
+	return func(s state.State, args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, badArguments(args)
+		}
+		a, ok := argAt[A](args, 0)
+		if !ok {
+			return nil, badArguments(args)
+		}
+		return result(f(s, a))
+	}
+}
+
+func adapt2[A, B, R any](f func(state.State, A, B) R) Dispatcher {
+	return func(s state.State, args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, badArguments(args)
+		}
+		a, aok := argAt[A](args, 0)
+		b, bok := argAt[B](args, 1)
+		if !aok || !bok {
+			return nil, badArguments(args)
+		}
+		return result(f(s, a, b))
+	}
+}
+
+// dispatcherFor returns a Dispatcher for the provided extension function,
+// calling functions with common signatures directly, and all others through
+// a reflect.Value resolved once.
+func dispatcherFor(fn interface{}) Dispatcher {
+	switch f := fn.(type) {
+	case func(state.State) bool:
+		return adapt0(f)
+	case func(state.State) error:
+		return adapt0(f)
+	case func(state.State) string:
+		return adapt0(f)
+	case func(state.State) interface{}:
+		return adapt0(f)
+	case func(state.State) context.Context:
+		return adapt0(f)
+	case func(state.State) log.Logger:
+		return adapt0(f)
+	case func(state.State) session.SessionStore:
+		return adapt0(f)
+	case func(state.State) store.Store:
+		return adapt0(f)
+	case func(state.State) (RequestFiles, error):
+		return adapt0E(f)
+	case func(state.State) map[string]string:
+		return adapt0(f)
+	case func(state.State) map[string]*http.Cookie:
+		return adapt0(f)
+	case func(state.State, int) error:
+		return adapt1(f)
+	case func(state.State, string) bool:
+		return adapt1(f)
+	case func(state.State, string) error:
+		return adapt1(f)
+	case func(state.State, string) string:
+		return adapt1(f)
+	case func(state.State, string) interface{}:
+		return adapt1(f)
+	case func(state.State, interface{}) error:
+		return adapt1(f)
+	case func(state.State, int, string) error:
+		return adapt2(f)
+	case func(state.State, string, string) error:
+		return adapt2(f)
+	case func(state.State, string, interface{}) error:
+		return adapt2(f)
+	case func(state.State, interface{}, string) error:
+		return adapt2(f)
+	case func(state.State, interface{}, interface{}) error:
+		return adapt2(f)
+	}
+	return reflectDispatcher(reflect.ValueOf(fn))
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func reflectDispatcher(v reflect.Value) Dispatcher {
+	t := v.Type()
+	return func(s state.State, args ...interface{}) (interface{}, error) {
+		switch {
+		case t.NumIn() < 1,
+			!t.IsVariadic() && t.NumIn() != len(args)+1,
+			t.IsVariadic() && t.NumIn()-1 > len(args)+1:
+			return nil, badArguments(args)
+		}
+		in := make([]reflect.Value, 0, len(args)+1)
+		in = append(in, reflect.ValueOf(s))
+		for i, arg := range args {
+			pt := t.In(t.NumIn() - 1)
+			if i+1 < t.NumIn()-1 || !t.IsVariadic() {
+				pt = t.In(i + 1)
+			} else {
+				pt = pt.Elem()
+			}
+			if arg == nil {
+				in = append(in, reflect.Zero(pt))
+				continue
+			}
+			av := reflect.ValueOf(arg)
+			if !av.Type().AssignableTo(pt) {
+				return nil, badArguments(args)
+			}
+			in = append(in, av)
+		}
+		out := v.Call(in)
+		var ret interface{}
+		var err error
+		for _, o := range out {
+			if o.Type() == errorType {
+				if !o.IsNil() {
+					err = o.Interface().(error)
+				}
+				continue
+			}
+			ret = o.Interface()
+		}
+		return ret, err
+	}
+}
+
+// Dispatch calls the named extension function through the precompiled
+// Dispatcher of the App handling the current request, avoiding a name lookup
+// and reflection on the State for common function signatures. Functions
+// namespaced to the blueprint of the request route take precedence over app
+// functions, as with State Call. Dispatch falls back to State Call when no
+// Dispatcher is available.
+func Dispatch(s state.State, name string, args ...interface{}) (interface{}, error) {
+	rq := s.Request()
+	if r := requestOf(rq); r != nil && r.app != nil {
+		if d, ok := r.app.ScopedDispatcher(scopeOf(r.app, rq), name); ok {
+			return d(s, args...)
+		}
+	}
+	return s.Call(name, args...)
+}
@@ -0,0 +1,170 @@
+package app_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func benchmarkInState(b *testing.B, fn func(state.State)) {
+	a := app.New("benchmark_dispatch", app.Mode("Testing", true))
+	a.GET("/", func(s state.State) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		fn(s)
+		b.StopTimer()
+	})
+	if err := a.Configure(); err != nil {
+		b.Fatal(err)
+	}
+	rq, _ := http.NewRequest("GET", "/", nil)
+	a.ServeHTTP(httptest.NewRecorder(), rq)
+}
+
+func BenchmarkCallStoredString(b *testing.B) {
+	benchmarkInState(b, func(s state.State) {
+		for i := 0; i < b.N; i++ {
+			s.Call("stored_string", "secret_key")
+		}
+	})
+}
+
+func BenchmarkDispatchStoredString(b *testing.B) {
+	benchmarkInState(b, func(s state.State) {
+		for i := 0; i < b.N; i++ {
+			app.Dispatch(s, "stored_string", "secret_key")
+		}
+	})
+}
+
+func BenchmarkCallModeIs(b *testing.B) {
+	benchmarkInState(b, func(s state.State) {
+		for i := 0; i < b.N; i++ {
+			s.Call("mode_is", "testing")
+		}
+	})
+}
+
+func BenchmarkDispatchModeIs(b *testing.B) {
+	benchmarkInState(b, func(s state.State) {
+		for i := 0; i < b.N; i++ {
+			app.Dispatch(s, "mode_is", "testing")
+		}
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	a := txst.TxstingApp(t, "dispatch")
+	x := expect(200, "GET", "/", func(s state.State) {
+		secret, err := app.Dispatch(s, "stored_string", "secret_key")
+		if err != nil || secret != a.String("secret_key") {
+			t.Errorf("dispatched stored_string was %v, %v, expected %q", secret, err, a.String("secret_key"))
+		}
+	})
+	txst.SimplePerformer(t, a, x).Perform()
+}
+
+func TestDispatchResults(t *testing.T) {
+	boxed := errors.New("an error value")
+	a := txst.TxstingApp(t, "dispatch_results", app.Extend(extension.New("results",
+		extension.NewFunction("boxed", func(state.State) interface{} { return boxed }),
+		extension.NewFunction("failing", func(state.State) error { return boxed }),
+		extension.NewFunction("add", func(s state.State, x, y int) int { return x + y }),
+		extension.NewFunction("sum", func(s state.State, name string, xs ...int) (string, error) {
+			if len(xs) == 0 {
+				return "", errors.New("nothing to sum")
+			}
+			var ret int
+			for _, x := range xs {
+				ret += x
+			}
+			return fmt.Sprintf("%s %d", name, ret), nil
+		}),
+	)))
+	x := expect(200, "GET", "/", func(s state.State) {
+		for _, c := range []struct {
+			name     string
+			args     []interface{}
+			expected interface{}
+			failed   bool
+		}{
+			{"boxed", nil, boxed, false},
+			{"failing", nil, nil, true},
+			{"add", []interface{}{1, 2}, 3, false},
+			{"add", []interface{}{1, "2"}, nil, true},
+			{"add", []interface{}{1}, nil, true},
+			{"sum", []interface{}{"total", 1, 2, 3}, "total 6", false},
+			{"sum", []interface{}{"total", 1, "2"}, nil, true},
+			{"sum", []interface{}{"total"}, "", true},
+		} {
+			v, err := app.Dispatch(s, c.name, c.args...)
+			if (err != nil) != c.failed || (!c.failed && v != c.expected) {
+				t.Errorf("%s%v dispatched %v, %v, expected %v, failed: %t", c.name, c.args, v, err, c.expected, c.failed)
+			}
+		}
+	})
+	txst.SimplePerformer(t, a, x).Perform()
+}
+
+func greeting(value string) extension.Extension {
+	return extension.New(
+		"greeting_"+value,
+		extension.NewFunction("greeting", func(s state.State) string { return value }),
+	)
+}
+
+func TestNamespace(t *testing.T) {
+	greets := func(expected string) state.Manage {
+		return func(s state.State) {
+			path := s.Request().URL.Path
+			if got, _ := app.Dispatch(s, "greeting"); got != expected {
+				t.Errorf("greeting dispatched at %s was %v, expected %s", path, got, expected)
+			}
+			if got, _ := s.Call("greeting"); got != expected {
+				t.Errorf("greeting called at %s was %v, expected %s", path, got, expected)
+			}
+		}
+	}
+	a := txst.TxstingApp(t, "namespace",
+		app.Extend(greeting("app")),
+		app.Namespace("/api", greeting("api")),
+		mounted("/api", "/site", greets("api")),
+	)
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/api/site", nil),
+		expect(200, "GET", "/site", greets("app")),
+		expect(200, "GET", "/api/root", greets("app")),
+		expect(200, "GET", "/apiary", greets("app")),
+	).Perform()
+
+	var scoped bool
+	for _, r := range a.Environment.Registered() {
+		if r.Name == "greeting" && r.Scope == "/api" && r.Extension == "greeting_api" {
+			scoped = true
+		}
+	}
+	if !scoped {
+		t.Errorf("namespaced greeting was not listed in %v", a.Environment.Registered())
+	}
+}
+
+func TestNamespaceConflicts(t *testing.T) {
+	a := app.New("namespace_conflicts")
+	a.Namespace("/api", greeting("api"))
+	a.Namespace("/api", greeting("other"))
+	a.Namespace("/other", greeting("app"))
+	cs := a.Conflicts()
+	if len(cs) != 1 {
+		t.Fatalf("expected a conflict within the /api namespace, got %v", cs)
+	}
+	if c, ok := cs[0].(app.Conflict); !ok || c.Name != "greeting" || c.Extension != "greeting_other" {
+		t.Errorf("unexpected conflict %v", cs[0])
+	}
+}
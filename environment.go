@@ -13,13 +13,14 @@ import (
 )
 
 // Environment is an interface for central storage and access of crucial app
-// functionality. These include State creation, Logging, and app Mode
-// determination and setting, in addition to package external Assets,
-// Extension, Session, Static, Store, and Templates.
+// functionality. These include State creation, Logging, app Mode
+// determination and setting, and extension function Registry, in addition to
+// package external Assets, Extension, Session, Static, Store, and Templates.
 type Environment interface {
 	Statr
 	Logr
 	Modr
+	Registry
 	asset.Assets
 	extension.Extension
 	session.Sessions
@@ -32,6 +33,7 @@ type environment struct {
 	Logr
 	Modr
 	Statr
+	*registry
 	asset.Assets
 	extension.Extension
 	session.Sessions
@@ -43,12 +45,16 @@ type environment struct {
 func newEnvironment(app *App) Environment {
 	st := defaultStore()
 	as := asset.New()
+	bx := builtInExtensions(app)
+	ext := extension.New("BuiltIn_Extension")
+	ext.Extend(bx...)
 	return &environment{
 		Logr:      DefaultLogr(),
 		Modr:      DefaultModr(),
 		Statr:     DefaultStatr(),
+		registry:  newRegistry(ext, bx...),
 		Assets:    as,
-		Extension: BuiltInExtension(app),
+		Extension: ext,
 		Store:     st,
 		Sessions:  session.NewSessions(st),
 		Static:    static.New(st, as),
@@ -56,12 +62,51 @@ func newEnvironment(app *App) Environment {
 	}
 }
 
+// Extend adds the provided extension.Extensions, with any function conflicting
+// with an already registered function replacing it, and the Conflict listed
+// in Conflicts. Configuring an App fails on conflicts between functions that
+// are not built in, and warns of others; use Override to replace functions
+// intentionally.
+func (e *environment) Extend(xs ...extension.Extension) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conflict(e.check(xs...)...)
+	e.record(xs...)
+	e.Extension.Extend(xs...)
+}
+
+// ExtendChecked adds the provided extension.Extensions, unless any function
+// conflicts with an already registered function, returning the first
+// conflict.
+func (e *environment) ExtendChecked(xs ...extension.Extension) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if errs := e.check(xs...); len(errs) > 0 {
+		return errs[0]
+	}
+	e.record(xs...)
+	e.Extension.Extend(xs...)
+	return nil
+}
+
+// Override adds the provided extension.Extensions, intentionally replacing
+// any registered function of the same name.
+func (e *environment) Override(xs ...extension.Extension) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record(xs...)
+	e.Extension.Extend(xs...)
+}
+
 func defaultStore() store.Store {
 	s := store.New()
 	s.Add("upload_size", "10000000")
+	s.Add("upload_memory", "1048576")
 	s.Add("secret_key", "Flotilla;Secret;Key:1")
 	s.Add("session_cookiename", "session")
 	s.Add("session_lifetime", "2629743")
+	s.Add("session_failure", SessionFail)
+	s.Add("session_lazy", "true")
 	s.Add("working_path", workingPath)
 	s.Add("flotilla_path", FlotillaPath)
 	s.Add("static_directories", workingStatic)
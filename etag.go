@@ -0,0 +1,223 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flxtilla/cxre/engine"
+	"github.com/flxtilla/cxre/state"
+)
+
+// etagWriter is an http.ResponseWriter buffering successful GET and HEAD
+// responses to generate an ETag, answering matching conditional requests with
+// 304. Responses exceeding the buffer limit, flushed, or hijacked, are passed
+// through without an ETag.
+type etagWriter struct {
+	http.ResponseWriter
+	rq          *http.Request
+	weak        bool
+	limit       int
+	code        int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (e *etagWriter) WriteHeader(code int) {
+	if e.passthrough {
+		e.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if e.code == 0 {
+		e.code = code
+	}
+}
+
+func (e *etagWriter) Write(b []byte) (int, error) {
+	if e.passthrough {
+		return e.ResponseWriter.Write(b)
+	}
+	n, _ := e.buf.Write(b)
+	if e.buf.Len() > e.limit {
+		if err := e.release(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// release stops buffering, writing any buffered response.
+func (e *etagWriter) release() error {
+	if e.passthrough {
+		return nil
+	}
+	e.passthrough = true
+	if e.code != 0 {
+		e.ResponseWriter.WriteHeader(e.code)
+	}
+	if e.buf.Len() == 0 {
+		return nil
+	}
+	_, err := e.ResponseWriter.Write(e.buf.Bytes())
+	e.buf.Reset()
+	return err
+}
+
+func (e *etagWriter) Flush() {
+	e.release()
+	if f, ok := e.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (e *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := e.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	e.passthrough = true
+	return h.Hijack()
+}
+
+func (e *etagWriter) etag() string {
+	h := fnv.New64a()
+	h.Write(e.buf.Bytes())
+	tag := `"` + strconv.FormatInt(int64(e.buf.Len()), 16) + "-" + strconv.FormatUint(h.Sum64(), 16) + `"`
+	if e.weak {
+		tag = "W/" + tag
+	}
+	return tag
+}
+
+// close finishes a buffered response, with an ETag, or as 304 when the
+// request conditions match.
+func (e *etagWriter) close() {
+	if e.passthrough {
+		return
+	}
+	if e.code == 0 && e.buf.Len() == 0 {
+		e.passthrough = true
+		return
+	}
+	if e.code == 0 || e.code == http.StatusOK {
+		h := e.Header()
+		if h.Get("ETag") == "" {
+			h.Set("ETag", e.etag())
+		}
+		if notModified(e.rq, h) {
+			e.passthrough = true
+			writeNotModified(e.ResponseWriter)
+			return
+		}
+	}
+	e.release()
+}
+
+// etagMatch reports whether the ETag matches any in a list of entity tags, as
+// with If-None-Match, using weak comparison.
+func etagMatch(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether a GET or HEAD request is conditional on an
+// If-None-Match matching the response ETag, or, without If-None-Match, on an
+// If-Modified-Since not before the response Last-Modified.
+func notModified(rq *http.Request, h http.Header) bool {
+	if rq.Method != http.MethodGet && rq.Method != http.MethodHead {
+		return false
+	}
+	if inm := rq.Header.Get("If-None-Match"); inm != "" {
+		return h.Get("ETag") != "" && etagMatch(inm, h.Get("ETag"))
+	}
+	ims, err := http.ParseTime(rq.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lm.Truncate(time.Second).After(ims)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	if h.Get("ETag") != "" {
+		h.Del("Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+func etagState(a *App, weak bool) StateWrapFn {
+	return func(mk state.Make) state.Make {
+		return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
+			r := requestOf(rq)
+			_, ok := rw.(*etagWriter)
+			if ok || r == nil || (rq.Method != http.MethodGet && rq.Method != http.MethodHead) {
+				return mk(rw, rq, rs, m)
+			}
+			ew := &etagWriter{
+				ResponseWriter: rw,
+				rq:             rq,
+				weak:           weak,
+				limit:          int(storedSize(a, "etag_max_size", 1<<20)),
+			}
+			r.atFinish(ew.close)
+			return mk(ew, rq, rs, m)
+		}
+	}
+}
+
+// ETags returns a Config buffering successful GET and HEAD responses of up to
+// the "etag_max_size" Store value in bytes(default 1MB) to set a strong, or a
+// weak, ETag when none is set, responding 304 to requests with a matching
+// If-None-Match, or an If-Modified-Since not before any Last-Modified set.
+// Any Compression is applied before the ETag is generated.
+func ETags(weak bool) Config {
+	return DefaultConfig(func(a *App) error {
+		a.WrapStateFunctionOrdered(110, etagState(a, weak))
+		return nil
+	})
+}
+
+// lastModifiedFunc sets the Last-Modified response header, responding 304
+// when a GET or HEAD request is not modified since, returning whether it did.
+func lastModifiedFunc(s state.State, t time.Time) bool {
+	rw := s.RWriter()
+	rw.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	rq := s.Request()
+	if rq.Header.Get("If-None-Match") != "" || !notModified(rq, rw.Header()) {
+		return false
+	}
+	writeNotModified(rw)
+	rw.WriteHeaderNow()
+	return true
+}
+
+// Provided a State and a time, LastModified sets the Last-Modified response
+// header from the time, e.g. the modification time of handler data, returning
+// true when a 304 response was written, as the request was not modified
+// since, after which the handler should not write a response.
+func LastModified(s state.State, t time.Time) bool {
+	ret, err := Dispatch(s, "last_modified", t)
+	if err != nil {
+		return false
+	}
+	nm, _ := ret.(bool)
+	return nm
+}
@@ -0,0 +1,31 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func TestETags(t *testing.T) {
+	a := txst.TxstingApp(t, "etags", app.ETags(false))
+	var etag string
+	tagged := expect(200, "GET", "/", func(s state.State) {
+		s.Call("serve_plain", 200, "tagged")
+	}).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+		etag = rw.Header().Get("ETag")
+		if etag == "" || rw.Body.String() != "tagged" {
+			t.Fatalf("expected a tagged response, got %q %q", etag, rw.Body.String())
+		}
+	})
+	txst.SimplePerformer(t, a, tagged).Perform()
+	notModified := expect(304, "GET", "/", nil, "If-None-Match", etag).
+		check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+			if rw.Body.Len() != 0 {
+				t.Errorf("expected an empty 304 response, got %q", rw.Body.String())
+			}
+		})
+	txst.SimplePerformer(t, a, notModified).Perform()
+}
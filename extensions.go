@@ -1,8 +1,6 @@
 package app
 
 import (
-	"mime/multipart"
-
 	ce "github.com/flxtilla/app/extensions/cookie"
 	re "github.com/flxtilla/app/extensions/response"
 	se "github.com/flxtilla/app/extensions/session"
@@ -17,30 +15,6 @@ func mkFunction(k string, v interface{}) extension.Function {
 	return extension.NewFunction(k, v)
 }
 
-// RequestFiles is a map keyed to string containing values of array of
-// mulitpart.FileHeader.
-type RequestFiles map[string][]*multipart.FileHeader
-
-// Files extracts uploaded files from http.Request, specifically though
-// request.MultipartForm.File.
-func Files(s state.State) RequestFiles {
-	f, err := s.Call("files")
-	if err == nil {
-		if files, ok := f.(RequestFiles); ok {
-			return files
-		}
-	}
-	return nil
-}
-
-func files(s state.State) RequestFiles {
-	rq := s.Request()
-	if rq.MultipartForm.File != nil {
-		return rq.MultipartForm.File
-	}
-	return nil
-}
-
 func modeIsFunc(a *App) func(s state.State, is string) bool {
 	return func(s state.State, is string) bool {
 		return a.GetMode(is)
@@ -63,8 +37,11 @@ func storeQueryFunc(a *App) func(state.State) store.Store {
 
 // Provide a State, Stored returns a store.Store instance.
 func Stored(s state.State) store.Store {
-	if st, err := s.Call("store"); err == nil {
-		return st.(store.Store)
+	if st, err := Dispatch(s, "store"); err == nil {
+		if ret, ok := st.(store.Store); ok {
+			return ret
+		}
+		mistyped(s, "store", st, "store.Store")
 	}
 	return nil
 }
@@ -112,12 +89,24 @@ func urlForFunc(a *App) func(state.State, string, bool, []string) (string, error
 
 func stateExtension(a *App) extension.Extension {
 	stateFns := []extension.Function{
-		mkFunction("files", files),
+		mkFunction("abort", abortFunc(a)),
+		mkFunction("bind", bindFunc(a)),
+		mkFunction("context", contextFunc),
+		mkFunction("files", filesFunc(a)),
+		mkFunction("last_modified", lastModifiedFunc),
+		mkFunction("logger", loggerFunc(a)),
 		mkFunction("mode_is", modeIsFunc(a)),
+		mkFunction("open_file", openFileFunc(a)),
+		mkFunction("request_id", requestIDFunc),
+		mkFunction("save_file", saveFileFunc(a)),
+		mkFunction("send_download", sendDownloadFunc(a)),
+		mkFunction("send_file", sendFileFunc(a)),
 		mkFunction("status", statusFunc(a)),
 		mkFunction("store", storeQueryFunc(a)),
 		mkFunction("stored_string", StoredString),
 		mkFunction("url_for", urlForFunc(a)),
+		mkFunction("validate", validateFunc),
+		mkFunction("with_value", withValueFunc),
 	}
 
 	return extension.New("State_Extension", stateFns...)
@@ -129,13 +118,19 @@ var extensions = []extension.Extension{
 	se.Extension,
 }
 
+// builtInExtensions lists the built in extensions, with the App & State
+// dependent functions last, replacing standalone functions of the same name,
+// e.g. the response extension abort.
+func builtInExtensions(a *App) []extension.Extension {
+	return append(append([]extension.Extension(nil), extensions...), stateExtension(a))
+}
+
 // Provided an App instance, BuiltInExtension returns a default
 // extension.Extension that includes extensions for cookies, responses, and
 // sessions, as well as several assorted App & State dependent extension
 // functions.
 func BuiltInExtension(a *App) extension.Extension {
 	ext := extension.New("BuiltIn_Extension")
-	ext.Extend(stateExtension(a))
-	ext.Extend(extensions...)
+	ext.Extend(builtInExtensions(a)...)
 	return ext
 }
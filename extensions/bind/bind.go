@@ -0,0 +1,239 @@
+// Package bind decodes request values into tagged Go structs, and validates
+// bound structs with declarative rules, reporting structured field errors.
+//
+// Struct fields are bound by tag, e.g. `form:"name"`, `query:"page"`,
+// `path:"id"`, or `file:"avatar"`, with rules declared in a validate tag,
+// e.g. `validate:"required,min=1,max=64,regex=^[a-z]+$,oneof=a b c"`.
+package bind
+
+import (
+	"encoding"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// fields calls fn for every settable field of the struct pointed to by dst,
+// including the fields of embedded and nested structs, with the field path
+// and the value of the field tag for the provided key.
+func fields(dst interface{}, key string, fn func(path, tag string, v reflect.Value)) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	walk(v.Elem(), "", key, fn)
+}
+
+func walk(v reflect.Value, prefix, key string, fn func(string, string, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+		path := prefix + f.Name
+		tag := f.Tag.Get(key)
+		if tag == "-" {
+			continue
+		}
+		if tag != "" || key == "validate" {
+			fn(path, tag, fv)
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			if f.Anonymous {
+				walk(fv, prefix, key, fn)
+			} else {
+				walk(fv, path+".", key, fn)
+			}
+		}
+	}
+}
+
+// Values binds values, e.g. url.Values, into the fields of the struct pointed
+// to by dst tagged with the provided key, returning FieldErrors for values
+// that could not be converted to the field type.
+func Values(dst interface{}, key string, values map[string][]string) error {
+	var errs FieldErrors
+	fields(dst, key, func(path, tag string, v reflect.Value) {
+		vs, ok := values[tag]
+		if !ok || !v.CanSet() {
+			return
+		}
+		if err := set(v, vs); err != nil {
+			errs = append(errs, FieldError{Field: path, Rule: "type", Param: v.Type().String(), Message: "must be a valid " + v.Type().String()})
+		}
+	})
+	return errs.Err()
+}
+
+// JSON decodes a JSON body into dst, returning a FieldError, of the field
+// path of dst, for a value of the wrong JSON type, or any other decoding error.
+// An empty body is not an error.
+func JSON(dst interface{}, r io.Reader) error {
+	err := json.NewDecoder(r).Decode(dst)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.UnmarshalTypeError:
+		return FieldError{Field: Path(dst, "json", e.Field), Rule: "type", Param: e.Type.String(), Message: "must be a valid " + e.Type.String()}
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Path returns the field path of the field of the struct pointed to by dst
+// named by the dot separated names of the provided tag key, e.g. a JSON field,
+// as reported by FieldErrors, or the names when no field matches.
+func Path(dst interface{}, key, names string) string {
+	if names == "" {
+		return names
+	}
+	if ret, ok := pathOf(reflect.TypeOf(dst), key, strings.Split(names, ".")); ok {
+		return ret
+	}
+	return names
+}
+
+func pathOf(t reflect.Type, key string, names []string) (string, bool) {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+	if len(names) == 0 {
+		return "", true
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := strings.Split(f.Tag.Get(key), ",")[0]
+		switch {
+		case name == "-":
+			continue
+		case name == "" && f.Anonymous:
+			if ret, ok := pathOf(f.Type, key, names); ok {
+				return ret, true
+			}
+			continue
+		case name == "":
+			name = f.Name
+		}
+		if !strings.EqualFold(name, names[0]) {
+			continue
+		}
+		if rest, ok := pathOf(f.Type, key, names[1:]); ok {
+			if rest == "" {
+				return f.Name, true
+			}
+			return f.Name + "." + rest, true
+		}
+	}
+	return "", false
+}
+
+// Files binds uploaded files into the fields of the struct pointed to by dst
+// tagged with "file", of type *multipart.FileHeader or []*multipart.FileHeader.
+func Files(dst interface{}, files map[string][]*multipart.FileHeader) error {
+	fields(dst, "file", func(path, tag string, v reflect.Value) {
+		fs, ok := files[tag]
+		if !ok || len(fs) == 0 || !v.CanSet() {
+			return
+		}
+		switch v.Type() {
+		case fileHeaderType:
+			v.Set(reflect.ValueOf(fs[0]))
+		case fileHeadersType:
+			v.Set(reflect.ValueOf(fs))
+		}
+	})
+	return nil
+}
+
+func set(v reflect.Value, vs []string) error {
+	if v.Kind() == reflect.Slice && v.Type() != fileHeadersType {
+		s := reflect.MakeSlice(v.Type(), len(vs), len(vs))
+		for i, one := range vs {
+			if err := setOne(s.Index(i), one); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	if len(vs) == 0 {
+		return nil
+	}
+	return setOne(v, vs[0])
+}
+
+func setOne(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		n := reflect.New(v.Type().Elem())
+		if err := setOne(n.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(n)
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err == nil {
+			v.SetInt(int64(d))
+		}
+		return err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		if s == "on" {
+			s = "true"
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return strconv.ErrSyntax
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package bind_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app/extensions/bind"
+)
+
+type Paging struct {
+	Page int `query:"page" validate:"min=1"`
+}
+
+type search struct {
+	Paging
+	Terms []string `query:"q" validate:"required,max=3"`
+	Sort  string   `query:"sort" validate:"oneof=asc desc"`
+	Code  string   `query:"code" validate:"regex=^[a-z]{2,4}$"`
+	Limit *uint    `query:"limit"`
+}
+
+func TestValues(t *testing.T) {
+	var s search
+	v := url.Values{"page": {"2"}, "q": {"a", "b"}, "sort": {"asc"}, "code": {"go"}, "limit": {"10"}}
+	if err := bind.Values(&s, "query", v); err != nil {
+		t.Fatal(err)
+	}
+	if err := bind.Validate(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Page != 2 || len(s.Terms) != 2 || s.Sort != "asc" || s.Limit == nil || *s.Limit != 10 {
+		t.Errorf("unexpected bound value %+v", s)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	var s search
+	v := url.Values{"page": {"x"}, "sort": {"up"}, "code": {"golang"}}
+	err := bind.Merge(bind.Values(&s, "query", v), bind.Validate(&s))
+	fe, ok := err.(bind.FieldErrors)
+	if !ok {
+		t.Fatalf("expected FieldErrors, got %v", err)
+	}
+	m := fe.Map()
+	for _, field := range []string{"Page", "Terms", "Sort", "Code"} {
+		if _, ok := m[field]; !ok {
+			t.Errorf("expected an error for field %s, got %v", field, m)
+		}
+	}
+	if fe[0].Rule != "type" {
+		t.Errorf(`expected the first rule to be "type", got %q`, fe[0].Rule)
+	}
+}
+
+func TestZeroValues(t *testing.T) {
+	var s search
+	v := url.Values{"page": {"0"}, "q": {"a"}, "sort": {"asc"}, "code": {"go"}}
+	err := bind.Merge(bind.Values(&s, "query", v), bind.Validate(&s))
+	fe, ok := err.(bind.FieldErrors)
+	if !ok || len(fe) != 1 || fe[0].Field != "Page" || fe[0].Rule != "min" {
+		t.Errorf("page 0 validated with %v, expected a min error for Page", err)
+	}
+}
+
+type address struct {
+	Zip int `json:"zip_code" validate:"min=1"`
+}
+
+type profile struct {
+	Name    string  `json:"name" validate:"required"`
+	Address address `json:"address"`
+	Age     int
+}
+
+func TestJSON(t *testing.T) {
+	for body, field := range map[string]string{
+		`{"name":"x","address":{"zip_code":"x"}}`: "Address.Zip",
+		`{"name":"x","age":"x"}`:                  "Age",
+	} {
+		var p profile
+		err := bind.JSON(&p, strings.NewReader(body))
+		fe, ok := err.(bind.FieldError)
+		if !ok || fe.Field != field || fe.Rule != "type" {
+			t.Errorf("%s bound with %v, expected a type error for %s", body, err, field)
+		}
+	}
+	var p profile
+	err := bind.Merge(bind.JSON(&p, strings.NewReader(`{"address":{"zip_code":-1}}`)), bind.Validate(&p))
+	fe, ok := err.(bind.FieldErrors)
+	if !ok {
+		t.Fatalf("expected FieldErrors, got %v", err)
+	}
+	if _, ok := fe.Map()["Address.Zip"]; !ok {
+		t.Errorf("expected validation errors by field path, got %v", fe.Map())
+	}
+	if err := bind.JSON(&p, strings.NewReader("")); err != nil {
+		t.Errorf("empty body bound with %v", err)
+	}
+}
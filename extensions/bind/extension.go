@@ -0,0 +1,121 @@
+package bind
+
+import (
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+func mkFunction(k string, v interface{}) extension.Function {
+	return extension.NewFunction(k, v)
+}
+
+var bindFns = []extension.Function{
+	mkFunction("bind", Binder{}.Bind),
+	mkFunction("validate", validateState),
+}
+
+// Extension provides the "bind" and "validate" functions for States without
+// a flotilla App, binding with the zero Binder. An App registers its own,
+// binding route parameters and uploads, bounded by the "upload_size" Store
+// value.
+var Extension extension.Extension = extension.New("Bind_Extension", bindFns...)
+
+// MaxBody is the default limit in bytes of request bodies bound by a Binder.
+const MaxBody = 32 << 20
+
+var badBody = xrr.NewXrror("unable to decode request body: %s").Out
+
+// Binder binds requests of a State into tagged structs. The zero Binder
+// limits bodies to MaxBody, parses multipart forms in memory, leaving no
+// temporary files to remove, and binds no route parameters.
+type Binder struct {
+	// Limit returns the limit in bytes of the request body.
+	Limit func(state.State) int64
+	// Uploads returns the parsed multipart form of the request.
+	Uploads func(state.State) (*multipart.Form, error)
+	// Params returns the route parameters of the request.
+	Params func(state.State) map[string][]string
+}
+
+func (b Binder) limit(s state.State) int64 {
+	if b.Limit != nil {
+		if l := b.Limit(s); l > 0 {
+			return l
+		}
+	}
+	return MaxBody
+}
+
+func (b Binder) uploads(s state.State, limit int64) (*multipart.Form, error) {
+	if b.Uploads != nil {
+		return b.Uploads(s)
+	}
+	rq := s.Request()
+	if rq.MultipartForm == nil {
+		rq.Body = http.MaxBytesReader(s.RWriter(), rq.Body, limit)
+		if err := rq.ParseMultipartForm(limit); err != nil {
+			return nil, badBody(err)
+		}
+	}
+	return rq.MultipartForm, nil
+}
+
+// body binds the request body into dst by content type: JSON bodies are
+// decoded with encoding/json, multipart forms bind "form" and "file" tagged
+// fields from the request uploads, and url encoded forms bind "form" tagged
+// fields.
+func (b Binder) body(s state.State, dst interface{}) error {
+	rq := s.Request()
+	if rq.Body == nil {
+		return nil
+	}
+	limit := b.limit(s)
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(rq.Header.Get("Content-Type"), ";", 2)[0]))
+	switch {
+	case ct == "application/json", strings.HasSuffix(ct, "+json"):
+		err := JSON(dst, http.MaxBytesReader(s.RWriter(), rq.Body, limit))
+		if _, ok := err.(FieldError); ok || err == nil {
+			return err
+		}
+		return badBody(err)
+	case strings.HasPrefix(ct, "multipart/"):
+		form, err := b.uploads(s, limit)
+		if err != nil || form == nil {
+			return err
+		}
+		return Merge(Values(dst, "form", form.Value), Files(dst, form.File))
+	case ct == "application/x-www-form-urlencoded":
+		rq.Body = http.MaxBytesReader(s.RWriter(), rq.Body, limit)
+		if err := rq.ParseForm(); err != nil {
+			return badBody(err)
+		}
+		return Values(dst, "form", rq.PostForm)
+	}
+	return nil
+}
+
+// Bind binds, in order, "query" tagged fields from the request query, the
+// request body, and "path" tagged fields from the route parameters, into the
+// struct pointed to by dst, then validates dst.
+func (b Binder) Bind(s state.State, dst interface{}) error {
+	errs := []error{Values(dst, "query", s.Request().URL.Query())}
+	if err := b.body(s, dst); err != nil {
+		if _, ok := Merge(err).(FieldErrors); !ok {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	if b.Params != nil {
+		errs = append(errs, Values(dst, "path", b.Params(s)))
+	}
+	return Merge(append(errs, Validate(dst))...)
+}
+
+func validateState(s state.State, v interface{}) error {
+	return Validate(v)
+}
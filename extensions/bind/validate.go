@@ -0,0 +1,209 @@
+package bind
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError is a validation or conversion failure of a single struct field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f FieldError) Error() string {
+	return fmt.Sprintf("%s %s", f.Field, f.Message)
+}
+
+// FieldErrors is a list of FieldError, usable as an error.
+type FieldErrors []FieldError
+
+func (f FieldErrors) Error() string {
+	var ret []string
+	for _, e := range f {
+		ret = append(ret, e.Error())
+	}
+	return strings.Join(ret, "; ")
+}
+
+// Err returns the FieldErrors as an error, or nil when empty.
+func (f FieldErrors) Err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Map returns the FieldErrors as a map of field to message, using the first
+// message for each field, e.g. for rendering alongside form fields in templates.
+func (f FieldErrors) Map() map[string]string {
+	ret := make(map[string]string)
+	for _, e := range f {
+		if _, ok := ret[e.Field]; !ok {
+			ret[e.Field] = e.Message
+		}
+	}
+	return ret
+}
+
+// Merge combines errors, flattening any FieldErrors, and returning
+// FieldErrors when all errors are FieldErrors, or else the first other error.
+func Merge(errs ...error) error {
+	var ret FieldErrors
+	for _, err := range errs {
+		switch e := err.(type) {
+		case nil:
+		case FieldErrors:
+			ret = append(ret, e...)
+		case FieldError:
+			ret = append(ret, e)
+		default:
+			return err
+		}
+	}
+	return ret.Err()
+}
+
+var regexps sync.Map
+
+func compiled(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(expr, re)
+	return re, nil
+}
+
+// Validate validates the struct pointed to by v against the rules of the
+// "validate" tags of its fields, returning FieldErrors for failed rules.
+//
+// Rules are comma separated: "required" (a non zero value), "min=n" and
+// "max=n" (the value of numbers, or the length of strings, slices and maps),
+// "regex=expr" (strings matching expr, which must be the last rule), and
+// "oneof=a b c" (one of the space separated values). Rules other than
+// "required" are not checked for nil pointers.
+func Validate(v interface{}) error {
+	var errs FieldErrors
+	fields(v, "validate", func(path, tag string, fv reflect.Value) {
+		if tag == "" {
+			return
+		}
+		for _, r := range rules(tag) {
+			if e, failed := check(fv, r[0], r[1]); failed {
+				e.Field = path
+				errs = append(errs, e)
+			}
+		}
+	})
+	return errs.Err()
+}
+
+func rules(tag string) [][2]string {
+	var ret [][2]string
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+		kv := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		ret = append(ret, [2]string{kv[0], kv[1]})
+	}
+	return ret
+}
+
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+func check(v reflect.Value, rule, param string) (FieldError, bool) {
+	e := FieldError{Rule: rule, Param: param}
+	if rule == "required" {
+		if v.IsZero() {
+			e.Message = "is required"
+			return e, true
+		}
+		return e, false
+	}
+	v, ok := indirect(v)
+	if !ok {
+		return e, false
+	}
+	switch rule {
+	case "min", "max":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			e.Message = "has an invalid rule " + rule + "=" + param
+			return e, true
+		}
+		value, length := measure(v)
+		if rule == "min" && value < n {
+			e.Message = "must be at least " + param + length
+			return e, true
+		}
+		if rule == "max" && value > n {
+			e.Message = "must be at most " + param + length
+			return e, true
+		}
+	case "regex":
+		re, err := compiled(param)
+		if err != nil {
+			e.Message = "has an invalid rule regex=" + param
+			return e, true
+		}
+		if v.Kind() == reflect.String && !re.MatchString(v.String()) {
+			e.Message = "must match " + param
+			return e, true
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, one := range strings.Fields(param) {
+			if s == one {
+				return e, false
+			}
+		}
+		e.Message = "must be one of " + strings.Join(strings.Fields(param), ", ")
+		return e, true
+	}
+	return e, false
+}
+
+// measure returns the value compared by min and max: the value of numbers, or
+// the length of strings, slices and maps, with a description of the unit.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	return 0, ""
+}
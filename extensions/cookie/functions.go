@@ -80,21 +80,6 @@ func unpackcookie(s state.State, cookie *http.Cookie) string {
 	return "cookie value could not be read and/or unpacked"
 }
 
-func headerModify(s state.State, action string, values ...[]string) error {
-	w := s.RWriter()
-	switch action {
-	case "set":
-		for _, v := range values {
-			w.Header().Set(v[0], v[1])
-		}
-	default:
-		for _, v := range values {
-			w.Header().Add(v[0], v[1])
-		}
-	}
-	return nil
-}
-
 func cookie(s state.State, secure bool, name string, value string, opts []interface{}) error {
 	if secure {
 		if secret := storedString(s, "SECRET_KEY"); secret != "" {
@@ -102,7 +87,7 @@ func cookie(s state.State, secure bool, name string, value string, opts []interf
 		}
 	}
 	cke := basiccookie(name, value, opts...)
-	headerModify(s, "add", []string{"Set-Cookie", cke})
+	s.RWriter().Header().Add("Set-Cookie", cke)
 	return nil
 }
 
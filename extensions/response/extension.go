@@ -13,8 +13,14 @@ var responseFns = []extension.Function{
 	mkFunction("header_modify", headerModify),
 	mkFunction("is_written", isWritten),
 	mkFunction("redirect", redirect),
+	mkFunction("respond", respond),
+	mkFunction("serve_csv", serveCSV),
 	mkFunction("serve_file", serveFile),
+	mkFunction("serve_json", serveJSON),
+	mkFunction("serve_jsonp", serveJSONP),
+	mkFunction("serve_ndjson", serveNDJSON),
 	mkFunction("serve_plain", servePlain),
+	mkFunction("serve_xml", serveXML),
 	mkFunction("write_to_response", writeToResponse),
 }
 
@@ -7,7 +7,9 @@ import (
 	"github.com/flxtilla/cxre/xrr"
 )
 
-func abort(s state.State, code int) error {
+// abort writes the status code, as the App abort does without StatusHandlers,
+// for States without the App. Any causes are ignored.
+func abort(s state.State, code int, causes ...interface{}) error {
 	if code >= 0 {
 		w := s.RWriter()
 		w.WriteHeader(code)
@@ -74,7 +76,7 @@ func redirect(s state.State, code int, location string) error {
 
 func servePlain(s state.State, code int, data string) error {
 	s.Push(func(ps state.State) {
-		headerWrite(ps, code, []string{"Content-Type", "text/plain"})
+		headerWrite(ps, code, []string{"Content-Type", PlainContentType})
 		ps.RWriter().Write([]byte(data))
 	})
 	return nil
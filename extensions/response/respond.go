@@ -0,0 +1,167 @@
+package response
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flxtilla/cxre/state"
+)
+
+// Media types offered by respond.
+const (
+	JSON  = "application/json"
+	XML   = "application/xml"
+	HTML  = "text/html"
+	Plain = "text/plain"
+)
+
+type defaultsKey struct{}
+
+type defaults struct {
+	media    string
+	template string
+}
+
+// Defaults returns a state.Manage setting route defaults for respond: the
+// media type preferred when the Accept header allows several, or is absent,
+// and the name of the template rendering HTML responses. HTML is only offered
+// when a template is set.
+func Defaults(media, template string) state.Manage {
+	return func(s state.State) {
+		s.Call("with_value", defaultsKey{}, defaults{media, template})
+	}
+}
+
+func defaultsOf(s state.State) defaults {
+	d, _ := requestContext(s).Value(defaultsKey{}).(defaults)
+	return d
+}
+
+type accepted struct {
+	media string
+	q     float64
+}
+
+// parseAccept returns the media ranges of an Accept header ordered by
+// quality, then specificity, with ranges of zero quality last.
+func parseAccept(header string) []accepted {
+	var ret []accepted
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		media := strings.ToLower(strings.TrimSpace(params[0]))
+		if media == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		ret = append(ret, accepted{media, q})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].q != ret[j].q {
+			return ret[i].q > ret[j].q
+		}
+		return strings.Count(ret[i].media, "*") < strings.Count(ret[j].media, "*")
+	})
+	return ret
+}
+
+func matches(media, offer string) bool {
+	switch {
+	case media == "*/*", media == offer:
+		return true
+	case strings.HasSuffix(media, "/*"):
+		return strings.HasPrefix(offer, strings.TrimSuffix(media, "*"))
+	}
+	return false
+}
+
+// refused reports whether the most specific media range matching the offer,
+// e.g. "text/*;q=0" for text/plain without a text/plain range, has zero
+// quality.
+func refused(accept []accepted, offer string) bool {
+	ret, specificity := false, -1
+	for _, a := range accept {
+		sp := 2 - strings.Count(a.media, "*")
+		if matches(a.media, offer) && sp > specificity {
+			ret, specificity = a.q == 0, sp
+		}
+	}
+	return ret
+}
+
+// Negotiate returns the first of the offered media types best matching the
+// Accept header, or an empty string when none match. All offers match an
+// empty header, returning the first offer, and offers refused with zero
+// quality, by type or by range, never match.
+func Negotiate(header string, offers ...string) string {
+	if strings.TrimSpace(header) == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return ""
+	}
+	accept := parseAccept(header)
+	for _, a := range accept {
+		if a.q == 0 {
+			break
+		}
+		for _, o := range offers {
+			if matches(a.media, o) && !refused(accept, o) {
+				return o
+			}
+		}
+	}
+	return ""
+}
+
+func offers(d defaults) []string {
+	ret := []string{JSON, XML}
+	if d.template != "" {
+		ret = append(ret, HTML)
+	}
+	ret = append(ret, Plain)
+	if d.media != "" {
+		for i, o := range ret {
+			if o == d.media {
+				ret = append([]string{o}, append(ret[:i:i], ret[i+1:]...)...)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// respond serves data as JSON, XML, HTML, or plain text, as negotiated from
+// the request Accept header and route Defaults, varying on Accept. When no
+// offered media type is acceptable, the 406 status is served.
+func respond(s state.State, code int, data interface{}) error {
+	d := defaultsOf(s)
+	media := Negotiate(s.Request().Header.Get("Accept"), offers(d)...)
+	s.RWriter().Header().Add("Vary", "Accept")
+	switch media {
+	case JSON:
+		return serveJSON(s, code, data)
+	case XML:
+		return serveXML(s, code, data)
+	case HTML:
+		s.Push(func(ps state.State) {
+			ps.RWriter().WriteHeader(code)
+			ps.Call("render_template", d.template, data)
+		})
+	case Plain:
+		serveBytes(s, code, PlainContentType, []byte(fmt.Sprint(data)))
+	default:
+		_, err := s.Call("status", 406)
+		return err
+	}
+	return nil
+}
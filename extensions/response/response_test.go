@@ -1 +1,107 @@
 package response_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/app/extensions/response"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+// expectation is a txst.Expectation sending additional request headers, and
+// expecting a response Content-Type and body when not empty.
+type expectation struct {
+	txst.Expectation
+	headers     []string
+	contentType string
+	body        string
+}
+
+func expect(code int, path string, m state.Manage, headers ...string) *expectation {
+	x, _ := txst.NewExpectation(code, "GET", path, func(t *testing.T) state.Manage { return m })
+	return &expectation{Expectation: x, headers: headers}
+}
+
+func (x *expectation) serving(contentType, body string) *expectation {
+	x.contentType, x.body = contentType, body
+	return x
+}
+
+func (x *expectation) Request() *http.Request {
+	rq := x.Expectation.Request()
+	for i := 0; i+1 < len(x.headers); i += 2 {
+		rq.Header.Set(x.headers[i], x.headers[i+1])
+	}
+	return rq
+}
+
+func (x *expectation) Response(t *testing.T, rw *httptest.ResponseRecorder) {
+	x.Expectation.Response(t, rw)
+	rq := x.Request()
+	if ct := rw.Header().Get("Content-Type"); x.contentType != "" && ct != x.contentType {
+		t.Errorf("%s served Content-Type %q, expected %q", rq.URL.Path, ct, x.contentType)
+	}
+	if body := rw.Body.String(); x.body != "" && body != x.body {
+		t.Errorf("%s served %q, expected %q", rq.URL.Path, body, x.body)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{response.JSON, response.XML, response.Plain}
+	for _, c := range []struct{ accept, expect string }{
+		{"", response.JSON},
+		{"text/*", response.Plain},
+		{"application/xml;q=0.9, text/plain", response.Plain},
+		{"application/json;q=0, */*;q=0.1", response.XML},
+		{"text/*;q=0, */*", response.JSON},
+		{"application/*;q=0, text/html", ""},
+		{"application/*;q=0, application/xml, */*;q=0.5", response.XML},
+		{"image/png", ""},
+	} {
+		if got := response.Negotiate(c.accept, offers...); got != c.expect {
+			t.Errorf("negotiated %q for %q, expected %q", got, c.accept, c.expect)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	a := txst.TxstingApp(t, "respond")
+	responds := func(s state.State) {
+		s.Call("respond", 200, "hello")
+	}
+	txst.MultiPerformer(t, a,
+		expect(200, "/default", responds).serving(response.JSONContentType, ""),
+		expect(200, "/plain", responds, "Accept", "text/plain").serving(response.PlainContentType, "hello"),
+		expect(200, "/xml", responds, "Accept", "application/xml, */*;q=0.1").serving(response.XMLContentType, ""),
+		expect(200, "/wildcard", responds, "Accept", "text/*;q=0, */*").serving(response.JSONContentType, ""),
+		expect(200, "/defaults", func(s state.State) {
+			response.Defaults(response.Plain, "")(s)
+			responds(s)
+		}, "Accept", "*/*").serving(response.PlainContentType, "hello"),
+		expect(406, "/refused", responds, "Accept", "text/*;q=0"),
+		expect(406, "/unacceptable", responds, "Accept", "image/png"),
+	).Perform()
+}
+
+func TestServeJSON(t *testing.T) {
+	serves := func(s state.State) {
+		s.Call("serve_json", 200, map[string]int{"one": 1})
+	}
+	jsonp := func(s state.State) {
+		if _, err := s.Call("serve_jsonp", 200, "alert(1)//", 1); err == nil {
+			t.Error("expected an invalid callback error")
+		}
+		s.Call("serve_jsonp", 200, "ns.cb", 1)
+	}
+	txst.MultiPerformer(t, txst.TxstingApp(t, "serve_json_development"),
+		expect(200, "/json", serves).serving(response.JSONContentType, "{\n  \"one\": 1\n}"),
+		expect(200, "/jsonp", jsonp).serving(response.JSONPContentType, `/**/ns.cb(1);`),
+	).Perform()
+	txst.MultiPerformer(t, txst.TxstingApp(t, "serve_json_production", app.Mode("Production", true)),
+		expect(200, "/json", serves).serving(response.JSONContentType, `{"one":1}`),
+		expect(200, "/jsonp", jsonp).serving(response.JSONPContentType, `/**/ns.cb(1);`),
+	).Perform()
+}
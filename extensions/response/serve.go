@@ -0,0 +1,186 @@
+package response
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"regexp"
+
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// Content types set by the serve functions.
+const (
+	JSONContentType   = "application/json; charset=utf-8"
+	XMLContentType    = "application/xml; charset=utf-8"
+	CSVContentType    = "text/csv; charset=utf-8"
+	NDJSONContentType = "application/x-ndjson; charset=utf-8"
+	JSONPContentType  = "application/javascript; charset=utf-8"
+	PlainContentType  = "text/plain; charset=utf-8"
+)
+
+var (
+	InvalidCallback = xrr.NewXrror("invalid JSONP callback name %q").Out
+	NotStreamable   = xrr.NewXrror("cannot stream %T as NDJSON, expected a slice or a channel").Out
+)
+
+func modeIs(s state.State, mode string) bool {
+	is, err := s.Call("mode_is", mode)
+	if err != nil {
+		return false
+	}
+	b, _ := is.(bool)
+	return b
+}
+
+// pretty reports whether serialized output should be indented, as it is in
+// Development mode, unless also in Production mode.
+func pretty(s state.State) bool {
+	return modeIs(s, "development") && !modeIs(s, "production")
+}
+
+func marshalJSON(s state.State, data interface{}) ([]byte, error) {
+	if pretty(s) {
+		return json.MarshalIndent(data, "", "  ")
+	}
+	return json.Marshal(data)
+}
+
+func marshalXML(s state.State, data interface{}) ([]byte, error) {
+	var b []byte
+	var err error
+	if pretty(s) {
+		b, err = xml.MarshalIndent(data, "", "  ")
+	} else {
+		b, err = xml.Marshal(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func serveBytes(s state.State, code int, contentType string, data []byte) {
+	s.Push(func(ps state.State) {
+		headerWrite(ps, code, []string{"Content-Type", contentType})
+		ps.RWriter().Write(data)
+	})
+}
+
+func serveJSON(s state.State, code int, data interface{}) error {
+	b, err := marshalJSON(s, data)
+	if err != nil {
+		return err
+	}
+	serveBytes(s, code, JSONContentType, b)
+	return nil
+}
+
+func serveXML(s state.State, code int, data interface{}) error {
+	b, err := marshalXML(s, data)
+	if err != nil {
+		return err
+	}
+	serveBytes(s, code, XMLContentType, b)
+	return nil
+}
+
+func serveCSV(s state.State, code int, rows [][]string) error {
+	s.Push(func(ps state.State) {
+		headerWrite(ps, code, []string{"Content-Type", CSVContentType})
+		w := csv.NewWriter(ps.RWriter())
+		w.WriteAll(rows)
+	})
+	return nil
+}
+
+func requestContext(s state.State) context.Context {
+	if c, err := s.Call("context"); err == nil {
+		if ctx, ok := c.(context.Context); ok {
+			return ctx
+		}
+	}
+	return s.Request().Context()
+}
+
+// serveNDJSON streams a slice, or the values received from a channel until it
+// is closed, as newline delimited JSON, flushing after each value. Streaming
+// stops when the request context is done.
+func serveNDJSON(s state.State, code int, data interface{}) error {
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	case reflect.Chan:
+		if v.Type().ChanDir()&reflect.RecvDir == 0 {
+			return NotStreamable(data)
+		}
+	default:
+		return NotStreamable(data)
+	}
+	s.Push(func(ps state.State) {
+		headerWrite(ps, code, []string{"Content-Type", NDJSONContentType})
+		w := ps.RWriter()
+		w.WriteHeaderNow()
+		enc := json.NewEncoder(w)
+		f, _ := w.(http.Flusher)
+		emit := func(item reflect.Value) bool {
+			if err := enc.Encode(item.Interface()); err != nil {
+				return false
+			}
+			if f != nil {
+				f.Flush()
+			}
+			return true
+		}
+		done := requestContext(ps).Done()
+		if v.Kind() != reflect.Chan {
+			for i := 0; i < v.Len(); i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if !emit(v.Index(i)) {
+					return
+				}
+			}
+			return
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		}
+		for {
+			chosen, item, ok := reflect.Select(cases)
+			if chosen == 1 || !ok || !emit(item) {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+var jsonpCallback = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// serveJSONP serves data as JSON wrapped in a call to the named callback,
+// which must be a JavaScript identifier or dotted path of identifiers.
+func serveJSONP(s state.State, code int, callback string, data interface{}) error {
+	if len(callback) > 128 || !jsonpCallback.MatchString(callback) {
+		return InvalidCallback(callback)
+	}
+	b, err := marshalJSON(s, data)
+	if err != nil {
+		return err
+	}
+	out := make([]byte, 0, len(b)+len(callback)+8)
+	out = append(out, "/**/"+callback+"("...)
+	out = append(out, b...)
+	out = append(out, ");"...)
+	s.RWriter().Header().Set("X-Content-Type-Options", "nosniff")
+	serveBytes(s, code, JSONPContentType, out)
+	return nil
+}
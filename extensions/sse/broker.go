@@ -0,0 +1,165 @@
+package sse
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultIdle is the time a Broker keeps the history of a channel without
+// subscribers after its last Event or subscription.
+const DefaultIdle = 10 * time.Minute
+
+// A Broker distributes Events published to named channels to subscribers of
+// those channels, keeping a bounded history of recent Events per channel for
+// subscribers resuming from a Last-Event-ID. Channels without subscribers are
+// removed, with their history, once idle. Event IDs are assigned from a
+// sequence of the Broker, so that IDs are not reused by a channel after its
+// removal.
+type Broker struct {
+	mu       sync.Mutex
+	seq      uint64
+	history  int
+	buffer   int
+	idle     time.Duration
+	swept    time.Time
+	channels map[string]*channel
+}
+
+type channel struct {
+	recent []Event
+	subs   map[chan Event]struct{}
+	active time.Time
+}
+
+// DefaultBroker is the Broker used by the package Extension and Publish.
+var DefaultBroker = NewBroker(100)
+
+// NewBroker returns a Broker keeping the provided number of recent Events per
+// channel.
+func NewBroker(history int) *Broker {
+	return &Broker{
+		history:  history,
+		buffer:   64,
+		idle:     DefaultIdle,
+		swept:    time.Now(),
+		channels: make(map[string]*channel),
+	}
+}
+
+// SetIdle sets the time the Broker keeps the history of a channel without
+// subscribers after its last Event or subscription, DefaultIdle by default.
+func (b *Broker) SetIdle(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.idle = d
+}
+
+// channel returns the named channel, marked active, first removing idle
+// channels at most once an idle period.
+func (b *Broker) channel(name string) *channel {
+	now := time.Now()
+	if now.Sub(b.swept) >= b.idle {
+		b.swept = now
+		for n, c := range b.channels {
+			if len(c.subs) == 0 && now.Sub(c.active) >= b.idle {
+				delete(b.channels, n)
+			}
+		}
+	}
+	c, ok := b.channels[name]
+	if !ok {
+		c = &channel{subs: make(map[chan Event]struct{})}
+		b.channels[name] = c
+	}
+	c.active = now
+	return c
+}
+
+// Publish sends the Event to all subscribers of the named channel, returning
+// the Event as sent, with an ID assigned when the Event has none. Subscribers
+// too slow to keep up are unsubscribed, closing their Event channel, and are
+// expected to resume from their last received Event.
+func (b *Broker) Publish(name string, e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.channel(name)
+	b.seq++
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(b.seq, 10)
+	}
+	if b.history > 0 {
+		c.recent = append(c.recent, e)
+		if len(c.recent) > b.history {
+			c.recent = c.recent[len(c.recent)-b.history:]
+		}
+	}
+	for sub := range c.subs {
+		select {
+		case sub <- e:
+		default:
+			delete(c.subs, sub)
+			close(sub)
+		}
+	}
+	return e
+}
+
+// Subscribe returns a channel receiving Events published to the named
+// channel, preceded by any recent Events published after the Event with the
+// provided lastID, or by all recent Events for a lastID no longer in the
+// history, and a function ending the subscription.
+func (b *Broker) Subscribe(name, lastID string) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.channel(name)
+	var missed []Event
+	if lastID != "" {
+		missed = c.recent
+		for i, e := range c.recent {
+			if e.ID == lastID {
+				missed = c.recent[i+1:]
+				break
+			}
+		}
+	}
+	size := b.buffer
+	if len(missed) > size {
+		size = len(missed)
+	}
+	sub := make(chan Event, size)
+	for _, e := range missed {
+		sub <- e
+	}
+	c.subs[sub] = struct{}{}
+	var once sync.Once
+	return sub, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := c.subs[sub]; ok {
+				delete(c.subs, sub)
+				close(sub)
+			}
+			c.active = time.Now()
+			if len(c.subs) == 0 && len(c.recent) == 0 {
+				delete(b.channels, name)
+			}
+		})
+	}
+}
+
+// Subscribers returns the number of subscribers of the named channel.
+func (b *Broker) Subscribers(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.channels[name]; ok {
+		return len(c.subs)
+	}
+	return 0
+}
+
+// Publish publishes the Event to the named channel of the DefaultBroker.
+func Publish(name string, e Event) Event {
+	return DefaultBroker.Publish(name, e)
+}
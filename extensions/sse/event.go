@@ -0,0 +1,46 @@
+// Package sse provides Server-Sent Events streaming for flotilla apps, with
+// event ids, Last-Event-ID resume, retry hints, heartbeats, and an in-process
+// Broker publishing Events to named channels.
+package sse
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Event is a single Server-Sent Event. Data spanning several lines is sent
+// as several data fields.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+var newlines = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func (e Event) encode(b *bytes.Buffer) {
+	if e.ID != "" {
+		b.WriteString("id: " + newlines.Replace(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + newlines.Replace(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+}
+
+// Bytes returns the Event encoded as a text/event-stream frame.
+func (e Event) Bytes() []byte {
+	var b bytes.Buffer
+	e.encode(&b)
+	return b.Bytes()
+}
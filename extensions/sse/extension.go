@@ -0,0 +1,21 @@
+package sse
+
+import "github.com/flxtilla/cxre/extension"
+
+func mkFunction(k string, v interface{}) extension.Function {
+	return extension.NewFunction(k, v)
+}
+
+// NewExtension returns an extension.Extension serving and publishing to the
+// channels of the provided Broker, with the extension functions "sse" and
+// "sse_publish".
+func NewExtension(b *Broker) extension.Extension {
+	return extension.New(
+		"SSE_Extension",
+		mkFunction("sse", serve(b)),
+		mkFunction("sse_publish", publish(b)),
+	)
+}
+
+// Extension serves and publishes to the channels of the DefaultBroker.
+var Extension extension.Extension = NewExtension(DefaultBroker)
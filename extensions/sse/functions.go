@@ -0,0 +1,158 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flxtilla/cxre/state"
+)
+
+// A Writer writes Events to a text/event-stream response.
+type Writer struct {
+	w      http.ResponseWriter
+	f      http.Flusher
+	ctx    context.Context
+	lastID string
+	err    error
+}
+
+// Send writes and flushes the Event, returning any error writing, after which
+// the stream should be ended.
+func (w *Writer) Send(e Event) error {
+	if w.err != nil {
+		return w.err
+	}
+	if _, w.err = w.w.Write(e.Bytes()); w.err == nil && w.f != nil {
+		w.f.Flush()
+	}
+	return w.err
+}
+
+// Comment writes and flushes a comment, ignored by clients, e.g. to keep the
+// connection alive.
+func (w *Writer) Comment(c string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if _, w.err = w.w.Write([]byte(": " + newlines.Replace(c) + "\n\n")); w.err == nil && w.f != nil {
+		w.f.Flush()
+	}
+	return w.err
+}
+
+// Done returns a channel closed when the client disconnects or the request
+// is otherwise finished.
+func (w *Writer) Done() <-chan struct{} {
+	return w.ctx.Done()
+}
+
+// LastEventID returns the Last-Event-ID sent by a client resuming a stream.
+func (w *Writer) LastEventID() string {
+	return w.lastID
+}
+
+func requestContext(s state.State) context.Context {
+	if c, err := s.Call("context"); err == nil {
+		if ctx, ok := c.(context.Context); ok {
+			return ctx
+		}
+	}
+	return s.Request().Context()
+}
+
+func storedDuration(s state.State, key string, def time.Duration) time.Duration {
+	if v, err := s.Call("stored_string", key); err == nil {
+		if str, ok := v.(string); ok {
+			if d, err := time.ParseDuration(str); err == nil && d > 0 {
+				return d
+			}
+		}
+	}
+	return def
+}
+
+// Stream responds to the request with a text/event-stream, deferred as with
+// other responses, calling fn with a Writer until fn returns. A retry hint is
+// sent first when the "sse_retry" Store duration is set.
+func Stream(s state.State, fn func(*Writer) error) error {
+	s.Push(func(ps state.State) {
+		rw := ps.RWriter()
+		h := rw.Header()
+		h.Set("Content-Type", "text/event-stream; charset=utf-8")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+		rw.WriteHeader(http.StatusOK)
+		rw.WriteHeaderNow()
+		w := &Writer{
+			w:      rw,
+			ctx:    requestContext(ps),
+			lastID: ps.Request().Header.Get("Last-Event-ID"),
+		}
+		w.f, _ = rw.(http.Flusher)
+		if retry := storedDuration(ps, "sse_retry", 0); retry > 0 {
+			w.w.Write([]byte("retry: " + strconv.FormatInt(retry.Milliseconds(), 10) + "\n\n"))
+		}
+		if w.f != nil {
+			w.f.Flush()
+		}
+		fn(w)
+	})
+	return nil
+}
+
+// serve streams the Events of the named Broker channel, resuming from any
+// Last-Event-ID, with a heartbeat comment every "sse_heartbeat" Store
+// duration(default 15s), until the client disconnects.
+func serve(b *Broker) func(state.State, string) error {
+	return func(s state.State, name string) error {
+		heartbeat := storedDuration(s, "sse_heartbeat", 15*time.Second)
+		return Stream(s, func(w *Writer) error {
+			events, cancel := b.Subscribe(name, w.LastEventID())
+			defer cancel()
+			t := time.NewTicker(heartbeat)
+			defer t.Stop()
+			for {
+				select {
+				case <-w.Done():
+					return nil
+				case e, ok := <-events:
+					if !ok {
+						return nil
+					}
+					if err := w.Send(e); err != nil {
+						return err
+					}
+				case <-t.C:
+					if err := w.Comment("heartbeat"); err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}
+}
+
+// publish publishes data to the named Broker channel: an Event as is, a
+// string as the Event data, and any other value as JSON Event data.
+func publish(b *Broker) func(state.State, string, interface{}) error {
+	return func(s state.State, name string, data interface{}) error {
+		var e Event
+		switch d := data.(type) {
+		case Event:
+			e = d
+		case string:
+			e.Data = d
+		default:
+			j, err := json.Marshal(d)
+			if err != nil {
+				return err
+			}
+			e.Data = string(j)
+		}
+		b.Publish(name, e)
+		return nil
+	}
+}
@@ -0,0 +1,186 @@
+package sse_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/app/extensions/sse"
+	"github.com/flxtilla/cxre/state"
+)
+
+func TestEvent(t *testing.T) {
+	e := sse.Event{ID: "7", Event: "update", Data: "one\ntwo", Retry: 2 * time.Second}
+	expect := "id: 7\nevent: update\nretry: 2000\ndata: one\ndata: two\n\n"
+	if got := string(e.Bytes()); got != expect {
+		t.Errorf("encoded %q, expected %q", got, expect)
+	}
+}
+
+func TestBrokerResume(t *testing.T) {
+	b := sse.NewBroker(10)
+	for _, d := range []string{"a", "b", "c"} {
+		b.Publish("updates", sse.Event{Data: d})
+	}
+	events, cancel := b.Subscribe("updates", "1")
+	defer cancel()
+	b.Publish("updates", sse.Event{Data: "d"})
+	for _, expect := range []string{"b", "c", "d"} {
+		select {
+		case e := <-events:
+			if e.Data != expect {
+				t.Errorf("received %q, expected %q", e.Data, expect)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event received, expected %q", expect)
+		}
+	}
+	cancel()
+	if n := b.Subscribers("updates"); n != 0 {
+		t.Errorf("%d subscribers after cancel, expected 0", n)
+	}
+}
+
+func TestBrokerIdle(t *testing.T) {
+	b := sse.NewBroker(10)
+	b.SetIdle(10 * time.Millisecond)
+	b.Publish("idle", sse.Event{Data: "a"})
+	b.Publish("idle", sse.Event{Data: "b"})
+	time.Sleep(20 * time.Millisecond)
+	b.Publish("other", sse.Event{Data: "c"})
+	events, cancel := b.Subscribe("idle", "1")
+	defer cancel()
+	select {
+	case e := <-events:
+		t.Errorf("received %q from the history of an idle channel", e.Data)
+	default:
+	}
+}
+
+func TestBrokerIdleResume(t *testing.T) {
+	b := sse.NewBroker(10)
+	b.SetIdle(10 * time.Millisecond)
+	b.Publish("idle", sse.Event{Data: "a"})
+	b.Publish("idle", sse.Event{Data: "b"})
+	time.Sleep(20 * time.Millisecond)
+	b.Publish("other", sse.Event{Data: "c"})
+	e := b.Publish("idle", sse.Event{Data: "d"})
+	if e.ID == "1" || e.ID == "2" {
+		t.Errorf("event published after the channel was idle reused id %s", e.ID)
+	}
+	events, cancel := b.Subscribe("idle", "1")
+	defer cancel()
+	select {
+	case e := <-events:
+		if e.Data != "d" {
+			t.Errorf("resumed with %q, expected %q", e.Data, "d")
+		}
+	case <-time.After(time.Second):
+		t.Error("no event received resuming from an id of the removed history")
+	}
+}
+
+// streaming returns a test server streaming the "news" channel of the Broker,
+// with a heartbeat of the provided duration.
+func streaming(t *testing.T, b *sse.Broker, heartbeat string) *httptest.Server {
+	a := app.New("sse",
+		app.Mode("Testing", true),
+		app.Extend(sse.NewExtension(b)),
+		app.Store("sse_heartbeat:"+heartbeat),
+	)
+	a.GET("/news", func(s state.State) {
+		s.Call("sse", "news")
+	})
+	if err := a.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(a)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// stream requests the path of the server, returning a func reading the next
+// line of the stream, and a func disconnecting.
+func stream(t *testing.T, srv *httptest.Server, path string, headers ...string) (func() string, func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	rq, err := http.NewRequestWithContext(ctx, "GET", srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		rq.Header.Set(headers[i], headers[i+1])
+	}
+	rs, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rs.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("streamed with content type %q", ct)
+	}
+	r := bufio.NewReader(rs.Body)
+	next := func() string {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		return strings.TrimSuffix(l, "\n")
+	}
+	return next, func() {
+		cancel()
+		rs.Body.Close()
+	}
+}
+
+func waitFor(t *testing.T, b *sse.Broker, subscribers int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Subscribers("news") != subscribers {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers, expected %d", b.Subscribers("news"), subscribers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	srv := streaming(t, sse.NewBroker(10), "5ms")
+	next, disconnect := stream(t, srv, "/news")
+	defer disconnect()
+	for l := next(); l != ": heartbeat"; l = next() {
+		if l != "" {
+			t.Fatalf("streamed %q before a heartbeat", l)
+		}
+	}
+}
+
+func TestStreamLastEventID(t *testing.T) {
+	b := sse.NewBroker(10)
+	srv := streaming(t, b, "1m")
+	for _, d := range []string{"a", "b", "c"} {
+		b.Publish("news", sse.Event{Data: d})
+	}
+	next, disconnect := stream(t, srv, "/news", "Last-Event-ID", "1")
+	defer disconnect()
+	for _, expect := range []string{"id: 2", "data: b", "", "id: 3", "data: c", ""} {
+		if l := next(); l != expect {
+			t.Errorf("streamed %q, expected %q", l, expect)
+		}
+	}
+}
+
+func TestStreamDisconnect(t *testing.T) {
+	b := sse.NewBroker(10)
+	srv := streaming(t, b, "1m")
+	next, disconnect := stream(t, srv, "/news")
+	waitFor(t, b, 1)
+	b.Publish("news", sse.Event{Data: "a"})
+	if l := next(); l != "id: 1" {
+		t.Errorf("streamed %q, expected %q", l, "id: 1")
+	}
+	disconnect()
+	waitFor(t, b, 0)
+}
@@ -0,0 +1,429 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message and control frame opcodes.
+const (
+	ContinuationMessage = 0
+	TextMessage         = 1
+	BinaryMessage       = 2
+	CloseMessage        = 8
+	PingMessage         = 9
+	PongMessage         = 10
+)
+
+// Close status codes.
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseUnsupported   = 1003
+	CloseNoStatus      = 1005
+	CloseInvalidData   = 1007
+	ClosePolicy        = 1008
+	CloseTooLarge      = 1009
+	CloseInternal      = 1011
+)
+
+var (
+	// ErrClosed is returned writing to a Conn after a close frame was sent.
+	ErrClosed = errors.New("websocket: connection closed")
+	// ErrMessageType is returned writing a message that is not text or binary.
+	ErrMessageType = errors.New("websocket: invalid message type")
+)
+
+// A CloseError is returned reading from a Conn that received a close frame,
+// or that was closed for a protocol violation.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// A Conn is a WebSocket connection. A Conn supports one concurrent reader and
+// any number of concurrent writers.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	client      bool
+	deflate     bool
+	subprotocol string
+	limit       int64
+	frameSize   int
+	readErr     error
+	onPong      func([]byte)
+
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+func newConn(c net.Conn, br *bufio.Reader, client bool, o Options) *Conn {
+	if br == nil {
+		br = bufio.NewReader(c)
+	}
+	limit := o.MaxMessageSize
+	if limit <= 0 {
+		limit = DefaultMaxMessageSize
+	}
+	return &Conn{
+		conn:      c,
+		br:        br,
+		client:    client,
+		limit:     limit,
+		frameSize: o.FrameSize,
+	}
+}
+
+// Subprotocol returns the negotiated subprotocol, if any.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed reports whether per-message deflate was negotiated.
+func (c *Conn) Compressed() bool {
+	return c.deflate
+}
+
+// SetPongHandler sets a function called with the payload of received pongs.
+func (c *Conn) SetPongHandler(fn func([]byte)) {
+	c.onPong = fn
+}
+
+// SetReadDeadline sets the deadline for reads on the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// NetConn returns the underlying net.Conn.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	op      int
+	payload []byte
+}
+
+func protocolError(text string) error {
+	return &CloseError{Code: CloseProtocolError, Text: text}
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var f frame
+	var h [8]byte
+	if _, err := io.ReadFull(c.br, h[:2]); err != nil {
+		return f, err
+	}
+	f.fin = h[0]&0x80 != 0
+	f.rsv1 = h[0]&0x40 != 0
+	f.op = int(h[0] & 0x0f)
+	masked := h[1]&0x80 != 0
+	n := uint64(h[1] & 0x7f)
+	switch {
+	case h[0]&0x30 != 0:
+		return f, protocolError("reserved bits set")
+	case f.rsv1 && (!c.deflate || f.op == ContinuationMessage || f.op >= CloseMessage):
+		return f, protocolError("unexpected compressed frame")
+	case masked == c.client:
+		return f, protocolError("bad frame masking")
+	}
+	switch n {
+	case 126:
+		if _, err := io.ReadFull(c.br, h[:2]); err != nil {
+			return f, err
+		}
+		n = uint64(binary.BigEndian.Uint16(h[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, h[:8]); err != nil {
+			return f, err
+		}
+		n = binary.BigEndian.Uint64(h[:8])
+	}
+	if f.op >= CloseMessage && (!f.fin || n > 125) {
+		return f, protocolError("bad control frame")
+	}
+	if n > uint64(c.limit) {
+		return f, &CloseError{Code: CloseTooLarge, Text: "message too large"}
+	}
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return f, err
+		}
+	}
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return f, err
+	}
+	if masked {
+		mask(key, f.payload)
+	}
+	return f, nil
+}
+
+func mask(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+// fail records a read error, sending a close frame for protocol violations.
+func (c *Conn) fail(err error) (int, []byte, error) {
+	if ce, ok := err.(*CloseError); ok {
+		c.writeClose(ce.Code, ce.Text)
+	}
+	c.readErr = err
+	return 0, nil, err
+}
+
+// ReadMessage reads the next text or binary message, reassembling fragmented
+// messages, answering pings, and answering a received close frame, after
+// which a CloseError is returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	var op int
+	var msg []byte
+	var compressed, started bool
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return c.fail(err)
+		}
+		switch f.op {
+		case PingMessage:
+			c.writeControl(PongMessage, f.payload)
+			continue
+		case PongMessage:
+			if c.onPong != nil {
+				c.onPong(f.payload)
+			}
+			continue
+		case CloseMessage:
+			ce := &CloseError{Code: CloseNoStatus}
+			switch {
+			case len(f.payload) == 1:
+				return c.fail(protocolError("bad close frame"))
+			case len(f.payload) >= 2:
+				ce.Code = int(binary.BigEndian.Uint16(f.payload))
+				ce.Text = string(f.payload[2:])
+			}
+			reply := ce.Code
+			if reply == CloseNoStatus {
+				reply = CloseNormal
+			}
+			c.writeClose(reply, "")
+			c.readErr = ce
+			return 0, nil, ce
+		case ContinuationMessage:
+			if !started {
+				return c.fail(protocolError("unexpected continuation frame"))
+			}
+		case TextMessage, BinaryMessage:
+			if started {
+				return c.fail(protocolError("expected continuation frame"))
+			}
+			op, compressed, started = f.op, f.rsv1, true
+		default:
+			return c.fail(protocolError("unknown opcode"))
+		}
+		if int64(len(msg)+len(f.payload)) > c.limit {
+			return c.fail(&CloseError{Code: CloseTooLarge, Text: "message too large"})
+		}
+		msg = append(msg, f.payload...)
+		if f.fin {
+			break
+		}
+	}
+	if compressed {
+		var err error
+		if msg, err = decompress(msg, c.limit); err != nil {
+			return c.fail(err)
+		}
+	}
+	if op == TextMessage && !utf8.Valid(msg) {
+		return c.fail(&CloseError{Code: CloseInvalidData, Text: "invalid utf-8"})
+	}
+	return op, msg, nil
+}
+
+// writeFrame writes a single frame, with the write lock held.
+func (c *Conn) writeFrame(fin, rsv1 bool, op int, payload []byte) error {
+	var h [14]byte
+	h[0] = byte(op)
+	if fin {
+		h[0] |= 0x80
+	}
+	if rsv1 {
+		h[0] |= 0x40
+	}
+	n := 2
+	switch l := len(payload); {
+	case l <= 125:
+		h[1] = byte(l)
+	case l <= 0xffff:
+		h[1] = 126
+		binary.BigEndian.PutUint16(h[2:], uint16(l))
+		n += 2
+	default:
+		h[1] = 127
+		binary.BigEndian.PutUint64(h[2:], uint64(l))
+		n += 8
+	}
+	if c.client {
+		var key [4]byte
+		rand.Read(key[:])
+		h[1] |= 0x80
+		copy(h[n:], key[:])
+		n += 4
+		masked := make([]byte, len(payload))
+		copy(masked, payload)
+		mask(key, masked)
+		payload = masked
+	}
+	buf := make([]byte, 0, n+len(payload))
+	buf = append(buf, h[:n]...)
+	buf = append(buf, payload...)
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *Conn) writeControl(op int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	return c.writeFrame(true, false, op, payload)
+}
+
+func (c *Conn) writeClose(code int, text string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if len(text) > 123 {
+		text = text[:123]
+	}
+	return c.writeFrame(true, false, CloseMessage, append(payload, text...))
+}
+
+// WriteMessage writes a text or binary message, compressed when per-message
+// deflate was negotiated, and fragmented into frames of at most the Options
+// FrameSize when set.
+func (c *Conn) WriteMessage(op int, data []byte) error {
+	if op != TextMessage && op != BinaryMessage {
+		return ErrMessageType
+	}
+	compressed := c.deflate
+	if compressed {
+		var err error
+		if data, err = compress(data); err != nil {
+			return err
+		}
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	first := true
+	for {
+		chunk := data
+		if c.frameSize > 0 && len(chunk) > c.frameSize {
+			chunk = chunk[:c.frameSize]
+		}
+		data = data[len(chunk):]
+		frameOp := ContinuationMessage
+		if first {
+			frameOp = op
+		}
+		if err := c.writeFrame(len(data) == 0, compressed && first, frameOp, chunk); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		first = false
+	}
+}
+
+// Ping writes a ping frame with the provided payload of at most 125 bytes.
+func (c *Conn) Ping(payload []byte) error {
+	if len(payload) > 125 {
+		return protocolError("ping payload too large")
+	}
+	return c.writeControl(PingMessage, payload)
+}
+
+// CloseWith sends a close frame with the provided code and text, unless one
+// was already sent, and closes the underlying connection.
+func (c *Conn) CloseWith(code int, text string) error {
+	c.writeClose(code, text)
+	return c.conn.Close()
+}
+
+// Close closes the connection with the CloseNormal code.
+func (c *Conn) Close() error {
+	return c.CloseWith(CloseNormal, "")
+}
+
+var (
+	flateWriters = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	}}
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+	// deflateEnd completes a sync flushed stream with an empty final block.
+	deflateEnd = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+)
+
+func compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&b)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), deflateTail), nil
+}
+
+func decompress(data []byte, limit int64) ([]byte, error) {
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateEnd)))
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, &CloseError{Code: CloseInvalidData, Text: "invalid compressed message"}
+	}
+	if int64(len(b)) > limit {
+		return nil, &CloseError{Code: CloseTooLarge, Text: "message too large"}
+	}
+	return b, nil
+}
@@ -0,0 +1,72 @@
+// Package websocket provides RFC 6455 WebSocket connections for flotilla
+// routes, with ping/pong, close handshakes, fragmentation, and optional
+// per-message deflate, usable from any state.Manage.
+package websocket
+
+import (
+	"strconv"
+
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
+)
+
+func mkFunction(k string, v interface{}) extension.Function {
+	return extension.NewFunction(k, v)
+}
+
+func storedString(s state.State, key string) string {
+	if v, err := s.Call("stored_string", key); err == nil {
+		if str, ok := v.(string); ok {
+			return str
+		}
+	}
+	return ""
+}
+
+// options returns Options from the Store keys "websocket_compression"(true or
+// false, default false), and "websocket_max_message"(bytes, default
+// DefaultMaxMessageSize).
+func options(s state.State) Options {
+	var o Options
+	o.Compression = storedString(s, "websocket_compression") == "true"
+	if n, err := strconv.ParseInt(storedString(s, "websocket_max_message"), 10, 64); err == nil && n > 0 {
+		o.MaxMessageSize = n
+	}
+	return o
+}
+
+// Serve upgrades the request of the State to a WebSocket connection, calling
+// fn with the connection and closing the connection when fn returns. Any
+// session is released before upgrading, so that a session cookie is sent with
+// the handshake response; the State, its session, and Store, remain usable
+// within fn.
+func Serve(s state.State, o Options, fn func(*Conn)) error {
+	rw := s.RWriter()
+	s.SessionRelease(rw)
+	c, err := Upgrade(rw, s.Request(), o)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	fn(c)
+	return nil
+}
+
+// Handle returns a state.Manage upgrading requests to WebSocket connections
+// handled by fn, with Options from the Store.
+func Handle(fn func(state.State, *Conn)) state.Manage {
+	return func(s state.State) {
+		Serve(s, options(s), func(c *Conn) { fn(s, c) })
+	}
+}
+
+func upgrade(s state.State, fn func(*Conn)) error {
+	return Serve(s, options(s), fn)
+}
+
+// Extension provides the "websocket" extension function, upgrading the request
+// to a WebSocket connection handled by a provided func(*Conn).
+var Extension extension.Extension = extension.New(
+	"WebSocket_Extension",
+	mkFunction("websocket", upgrade),
+)
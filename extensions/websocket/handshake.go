@@ -0,0 +1,270 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultMaxMessageSize is the default limit of read message sizes.
+const DefaultMaxMessageSize = 1 << 20
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// deflateResponse is the negotiated per-message deflate extension. Context
+// takeover is disabled in both directions, compressing and decompressing
+// each message independently.
+const deflateResponse = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+var (
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	ErrBadOrigin    = errors.New("websocket: request origin not allowed")
+	ErrNotHijacker  = errors.New("websocket: response does not support hijacking")
+)
+
+// Options configures WebSocket connections.
+type Options struct {
+	// Subprotocols are the supported subprotocols, in order of preference.
+	Subprotocols []string
+	// Compression enables negotiating per-message deflate.
+	Compression bool
+	// MaxMessageSize limits the size of read messages, defaulting to
+	// DefaultMaxMessageSize.
+	MaxMessageSize int64
+	// FrameSize, when positive, fragments written messages into frames of at
+	// most FrameSize bytes.
+	FrameSize int
+	// CheckOrigin reports whether a request Origin is allowed, defaulting to
+	// allowing requests without an Origin, or with an Origin matching the
+	// request Host.
+	CheckOrigin func(*http.Request) bool
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hasToken reports whether the comma separated header values contain the
+// token, case insensitively.
+func hasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// acceptDeflate reports whether a per-message deflate offer can be accepted
+// with a full size window and no context takeover.
+func acceptDeflate(h http.Header) bool {
+	for _, v := range h.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(v, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			ok := true
+			for _, p := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				switch kv[0] {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					ok = ok && len(kv) == 2 && strings.Trim(kv[1], `"`) == "15"
+				default:
+					ok = false
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func subprotocol(r *http.Request, supported []string) string {
+	var requested []string
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			requested = append(requested, strings.TrimSpace(p))
+		}
+	}
+	for _, s := range supported {
+		for _, p := range requested {
+			if p == s {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func refuse(w http.ResponseWriter, code int, err error) error {
+	if code == http.StatusUpgradeRequired {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+	}
+	http.Error(w, http.StatusText(code), code)
+	return err
+}
+
+// Upgrade upgrades the request to a WebSocket connection, responding with an
+// error status when the request is not a valid WebSocket handshake. Headers
+// already set on the http.ResponseWriter, e.g. cookies, are sent with the
+// handshake response.
+func Upgrade(w http.ResponseWriter, r *http.Request, o Options) (*Conn, error) {
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, refuse(w, http.StatusMethodNotAllowed, ErrBadHandshake)
+	case !hasToken(r.Header, "Connection", "upgrade"), !hasToken(r.Header, "Upgrade", "websocket"):
+		return nil, refuse(w, http.StatusBadRequest, ErrBadHandshake)
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return nil, refuse(w, http.StatusUpgradeRequired, ErrBadHandshake)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, refuse(w, http.StatusBadRequest, ErrBadHandshake)
+	}
+	check := o.CheckOrigin
+	if check == nil {
+		check = sameOrigin
+	}
+	if !check(r) {
+		return nil, refuse(w, http.StatusForbidden, ErrBadOrigin)
+	}
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, refuse(w, http.StatusInternalServerError, ErrNotHijacker)
+	}
+	protocol := subprotocol(r, o.Subprotocols)
+	deflate := o.Compression && acceptDeflate(r.Header)
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if protocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + protocol + "\r\n")
+	}
+	if deflate {
+		b.WriteString("Sec-WebSocket-Extensions: " + deflateResponse + "\r\n")
+	}
+	for k, vs := range w.Header() {
+		switch http.CanonicalHeaderKey(k) {
+		case "Upgrade", "Connection", "Content-Type", "Content-Length":
+			continue
+		}
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "Sec-Websocket-") {
+			continue
+		}
+		for _, v := range vs {
+			b.WriteString(k + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(v) + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+
+	nc, brw, err := h.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := nc.Write([]byte(b.String())); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	c := newConn(nc, brw.Reader, false, o)
+	c.subprotocol, c.deflate = protocol, deflate
+	return c, nil
+}
+
+// Dial opens a client WebSocket connection to a ws:// or wss:// url, sending
+// any provided headers with the handshake request.
+func Dial(ctx context.Context, rawurl string, o Options, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	host := u.Host
+	var d net.Dialer
+	var nc net.Conn
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host += ":80"
+		}
+		nc, err = d.DialContext(ctx, "tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host += ":443"
+		}
+		td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: u.Hostname()}}
+		nc, err = td.DialContext(ctx, "tcp", host)
+	default:
+		return nil, nil, ErrBadHandshake
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	k := make([]byte, 16)
+	rand.Read(k)
+	key := base64.StdEncoding.EncodeToString(k)
+
+	rq := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: make(http.Header)}
+	for k, vs := range header {
+		rq.Header[k] = vs
+	}
+	rq.Header.Set("Upgrade", "websocket")
+	rq.Header.Set("Connection", "Upgrade")
+	rq.Header.Set("Sec-WebSocket-Key", key)
+	rq.Header.Set("Sec-WebSocket-Version", "13")
+	if len(o.Subprotocols) > 0 {
+		rq.Header.Set("Sec-WebSocket-Protocol", strings.Join(o.Subprotocols, ", "))
+	}
+	if o.Compression {
+		rq.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_no_context_takeover; server_no_context_takeover")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	if err := rq.Write(nc); err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(nc)
+	rs, err := http.ReadResponse(br, rq)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	if rs.StatusCode != http.StatusSwitchingProtocols ||
+		!hasToken(rs.Header, "Upgrade", "websocket") ||
+		rs.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		nc.Close()
+		return nil, rs, ErrBadHandshake
+	}
+	nc.SetDeadline(time.Time{})
+	c := newConn(nc, br, true, o)
+	c.subprotocol = rs.Header.Get("Sec-WebSocket-Protocol")
+	c.deflate = o.Compression && strings.HasPrefix(strings.TrimSpace(rs.Header.Get("Sec-WebSocket-Extensions")), "permessage-deflate")
+	return c, rs, nil
+}
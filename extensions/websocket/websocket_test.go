@@ -0,0 +1,123 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/app/extensions/websocket"
+	"github.com/flxtilla/cxre/state"
+)
+
+func echo(c *websocket.Conn) {
+	for {
+		op, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := c.WriteMessage(op, msg); err != nil {
+			return
+		}
+	}
+}
+
+func dial(t *testing.T, srv *httptest.Server, path string, o websocket.Options) *websocket.Conn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+path, o, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+func expectEcho(t *testing.T, c *websocket.Conn, op int, msg []byte) {
+	if err := c.WriteMessage(op, msg); err != nil {
+		t.Fatal(err)
+	}
+	gotOp, got, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotOp != op || !bytes.Equal(got, msg) {
+		t.Errorf("echoed %d %q, expected %d %q", gotOp, got, op, msg)
+	}
+}
+
+func TestFragmentedDeflate(t *testing.T) {
+	o := websocket.Options{Compression: true, FrameSize: 7}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Upgrade(w, r, o)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		echo(c)
+	}))
+	defer srv.Close()
+
+	c := dial(t, srv, "/", o)
+	defer c.Close()
+	if !c.Compressed() {
+		t.Error("expected per-message deflate to be negotiated")
+	}
+	expectEcho(t, c, websocket.TextMessage, []byte(strings.Repeat("fragmented & compressed ", 20)))
+	expectEcho(t, c, websocket.BinaryMessage, []byte{0, 1, 2, 3})
+
+	pong := make(chan string, 1)
+	c.SetPongHandler(func(b []byte) { pong <- string(b) })
+	if err := c.Ping([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	expectEcho(t, c, websocket.TextMessage, []byte("after ping"))
+	select {
+	case p := <-pong:
+		if p != "ping" {
+			t.Errorf("pong payload was %q, expected %q", p, "ping")
+		}
+	default:
+		t.Error("expected a pong")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	a := app.New("websocket", app.Mode("Testing", true), app.Store("websocket_greeting:!"))
+	a.GET("/ws", websocket.Handle(func(s state.State, c *websocket.Conn) {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.WriteMessage(websocket.TextMessage, append(msg, app.StoredString(s, "websocket_greeting")...))
+		c.ReadMessage()
+	}))
+	if err := a.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+
+	c := dial(t, srv, "/ws", websocket.Options{})
+	expectMsg := []byte("hello!")
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || !bytes.Equal(msg, expectMsg) {
+		t.Errorf("read %q %v, expected %q", msg, err, expectMsg)
+	}
+	c.CloseWith(websocket.CloseGoingAway, "done")
+
+	rs, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain request status was %d, expected %d", rs.StatusCode, http.StatusBadRequest)
+	}
+}
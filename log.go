@@ -1,30 +1,395 @@
 package app
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/flxtilla/cxre/log"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/xrr"
 )
 
 // Logr is an interface to logging that implements flotilla/log.Logger as well
-// as swap method for changing the Logger when needed.
+// as swap methods for changing the Logger or its output when needed, and a
+// method for creating Loggers tagged with request or other identifying
+// information.
+// Logr additionally manages log levels for the app and any number of named
+// subsystems, e.g. "sessions", "templates", "config", and "access".
 type Logr interface {
 	log.Logger
 	SwapLogger(log.Logger)
+	SwapOutput(io.Writer)
+	Tagged(...string) log.Logger
+	LogLevel(string) log.Level
+	SetLogLevel(string, log.Level)
+	LogLevels() map[string]log.Level
+	Subsystem(string, ...string) log.Logger
 }
 
+// Subsystems lists the named subsystems with default log levels, settable
+// from the Store with a key of "log_level_" plus the subsystem name.
+var Subsystems = []string{"sessions", "templates", "config", "access"}
+
+// defaultLogr holds the app log.Logger atomically, as levels and output may
+// change while requests are logging.
 type defaultLogr struct {
+	logger  atomic.Pointer[loggerRef]
+	out     io.Writer
+	mk      func(io.Writer, log.Level) log.Logger
+	swapped bool
+	mu      sync.RWMutex
+	levels  map[string]log.Level
+	subs    map[string]log.Logger
+}
+
+type loggerRef struct {
 	log.Logger
 }
 
+func (d *defaultLogr) current() log.Logger {
+	return d.logger.Load().Logger
+}
+
+func (d *defaultLogr) set(l log.Logger) {
+	d.logger.Store(&loggerRef{l})
+}
+
+func (d *defaultLogr) Print(v ...interface{})            { d.current().Print(v...) }
+func (d *defaultLogr) Printf(f string, v ...interface{}) { d.current().Printf(f, v...) }
+func (d *defaultLogr) Println(v ...interface{})          { d.current().Println(v...) }
+func (d *defaultLogr) Debug(v ...interface{})            { d.current().Debug(v...) }
+func (d *defaultLogr) Debugf(f string, v ...interface{}) { d.current().Debugf(f, v...) }
+func (d *defaultLogr) Info(v ...interface{})             { d.current().Info(v...) }
+func (d *defaultLogr) Infof(f string, v ...interface{})  { d.current().Infof(f, v...) }
+func (d *defaultLogr) Warn(v ...interface{})             { d.current().Warn(v...) }
+func (d *defaultLogr) Warnf(f string, v ...interface{})  { d.current().Warnf(f, v...) }
+func (d *defaultLogr) Error(v ...interface{})            { d.current().Error(v...) }
+func (d *defaultLogr) Errorf(f string, v ...interface{}) { d.current().Errorf(f, v...) }
+func (d *defaultLogr) Fatal(v ...interface{})            { d.current().Fatal(v...) }
+func (d *defaultLogr) Fatalf(f string, v ...interface{}) { d.current().Fatalf(f, v...) }
+func (d *defaultLogr) Panic(v ...interface{})            { d.current().Panic(v...) }
+func (d *defaultLogr) Panicf(f string, v ...interface{}) { d.current().Panicf(f, v...) }
+
 // SwapLogger changes the existing log.Logger to the provided log.Logger.
 func (d *defaultLogr) SwapLogger(l log.Logger) {
-	d.Logger = l
+	d.mu.Lock()
+	d.set(l)
+	d.swapped = true
+	d.subs = make(map[string]log.Logger)
+	d.mu.Unlock()
+}
+
+// SwapOutput changes the output of the Logr, and any Loggers it creates, to
+// the provided io.Writer, retaining all log levels.
+func (d *defaultLogr) SwapOutput(w io.Writer) {
+	d.mu.Lock()
+	d.out = w
+	d.set(d.mk(w, d.levels[""]))
+	d.swapped = false
+	d.subs = make(map[string]log.Logger)
+	d.mu.Unlock()
+}
+
+// Tagged returns a log.Logger writing to the same output as the Logr, with
+// each entry prefixed by the provided tags. A Logger provided by SwapLogger
+// cannot be tagged, and is returned as is.
+func (d *defaultLogr) Tagged(tags ...string) log.Logger {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.swapped {
+		return d.current()
+	}
+	return d.mk(&taggedWriter{
+		w:      d.out,
+		prefix: []byte("[" + strings.Join(tags, " ") + "] "),
+	}, d.levels[""])
+}
+
+func (d *defaultLogr) levelOf(subsystem string) log.Level {
+	if l, ok := d.levels[subsystem]; ok {
+		return l
+	}
+	return d.levels[""]
+}
+
+// LogLevel returns the log.Level for the named subsystem, or the app level when
+// the subsystem has no level of its own. An empty string names the app.
+func (d *defaultLogr) LogLevel(subsystem string) log.Level {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.levelOf(subsystem)
+}
+
+// SetLogLevel sets the log.Level for the named subsystem, with an empty string
+// setting the level of the app Logger.
+func (d *defaultLogr) SetLogLevel(subsystem string, l log.Level) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.levels[subsystem] = l
+	d.subs = make(map[string]log.Logger)
+	if subsystem == "" && !d.swapped {
+		d.set(d.mk(d.out, l))
+	}
+}
+
+// LogLevels returns a copy of all explicitly set log levels keyed by subsystem.
+func (d *defaultLogr) LogLevels() map[string]log.Level {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ret := make(map[string]log.Level, len(d.levels))
+	for k, v := range d.levels {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Subsystem returns a log.Logger for the named subsystem, logging at the
+// subsystem level and tagged with the subsystem name, and any provided tags.
+// Loggers without tags are cached, and tagged Loggers are made without
+// excluding other logging.
+func (d *defaultLogr) Subsystem(name string, tags ...string) log.Logger {
+	prefix := "[" + name + "] "
+	d.mu.RLock()
+	l, ok := d.subs[name]
+	if !ok || len(tags) > 0 {
+		swapped, out, lvl := d.swapped, d.out, d.levelOf(name)
+		d.mu.RUnlock()
+		if swapped {
+			return d.current()
+		}
+		if len(tags) > 0 {
+			prefix += "[" + strings.Join(tags, " ") + "] "
+			return d.mk(&taggedWriter{w: out, prefix: []byte(prefix)}, lvl)
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if l, ok := d.subs[name]; ok {
+			return l
+		}
+		l = d.mk(&taggedWriter{w: d.out, prefix: []byte(prefix)}, d.levelOf(name))
+		d.subs[name] = l
+		return l
+	}
+	d.mu.RUnlock()
+	return l
+}
+
+// accessWriter is an http.ResponseWriter recording the response status code
+// and size for the access log.
+type accessWriter struct {
+	http.ResponseWriter
+	code int
+	size int64
+}
+
+func (w *accessWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *accessWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	w.code = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// logAccess logs the finished request to the "access" subsystem, when the
+// subsystem logs at the info level.
+func logAccess(a *App, w *accessWriter, rq *http.Request, start time.Time) {
+	if a.LogLevel("access") < log.LInfo {
+		return
+	}
+	l := a.Subsystem("access")
+	if r := requestOf(rq); r != nil {
+		l = r.subsystem("access")
+	}
+	code := w.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	l.Infof("%s %s %d %d %s", rq.Method, rq.URL.RequestURI(), code, w.size, time.Since(start))
+}
+
+type taggedWriter struct {
+	w      io.Writer
+	prefix []byte
+}
+
+func (t *taggedWriter) Write(p []byte) (int, error) {
+	b := make([]byte, 0, len(t.prefix)+len(p))
+	b = append(append(b, t.prefix...), p...)
+	if _, err := t.w.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 // DefaultLogr returns the default flotilla Logger.
 func DefaultLogr() Logr {
-	return &defaultLogr{
-		Logger: log.New(os.Stdout, log.LInfo, log.DefaultTextFormatter()),
+	f := log.DefaultTextFormatter()
+	mk := func(w io.Writer, l log.Level) log.Logger {
+		return log.New(w, l, f)
+	}
+	d := &defaultLogr{
+		out:    os.Stdout,
+		mk:     mk,
+		levels: map[string]log.Level{"": log.LInfo},
+		subs:   make(map[string]log.Logger),
+	}
+	d.set(mk(os.Stdout, log.LInfo))
+	return d
+}
+
+var levelNames = map[string]log.Level{
+	"debug":   log.LDebug,
+	"info":    log.LInfo,
+	"warn":    log.LWarn,
+	"warning": log.LWarn,
+	"error":   log.LError,
+	"fatal":   log.LFatal,
+	"panic":   log.LPanic,
+}
+
+var invalidLevel = xrr.NewXrror("%s is not a valid log level").Out
+
+// ParseLevel returns the log.Level for the provided level name, e.g. "debug",
+// "info", "warn", "error", "fatal", or "panic".
+func ParseLevel(name string) (log.Level, error) {
+	if l, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return l, nil
 	}
+	return log.LInfo, invalidLevel(name)
+}
+
+func levelName(l log.Level) string {
+	for _, k := range []string{"debug", "info", "warn", "error", "fatal", "panic"} {
+		if levelNames[k] == l {
+			return k
+		}
+	}
+	return fmt.Sprintf("%v", l)
+}
+
+// modeLevel returns the default log level for the current app mode: debug in
+// Development, warn in Production, and info otherwise.
+func modeLevel(a *App) log.Level {
+	switch {
+	case a.GetMode("production"):
+		return log.LWarn
+	case a.GetMode("development"):
+		return log.LDebug
+	}
+	return log.LInfo
+}
+
+func cLogLevels(a *App) error {
+	app := modeLevel(a)
+	if v := a.String("log_level"); v != "" {
+		l, err := ParseLevel(v)
+		if err != nil {
+			return err
+		}
+		app = l
+	}
+	a.SetLogLevel("", app)
+	for _, sub := range Subsystems {
+		if v := a.String("log_level_" + sub); v != "" {
+			l, err := ParseLevel(v)
+			if err != nil {
+				return err
+			}
+			a.SetLogLevel(sub, l)
+		}
+	}
+	return nil
+}
+
+func levelsText(a *App) string {
+	subs := map[string]bool{"": true}
+	for _, sub := range Subsystems {
+		subs[sub] = true
+	}
+	for sub := range a.LogLevels() {
+		subs[sub] = true
+	}
+	var ret []string
+	for sub := range subs {
+		name := sub
+		if name == "" {
+			name = "app"
+		}
+		ret = append(ret, fmt.Sprintf("%s: %s", name, levelName(a.LogLevel(sub))))
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, "\n")
+}
+
+func logLevelsManage(a *App, guard func(state.State) bool) state.Manage {
+	return func(s state.State) {
+		if !guard(s) {
+			s.Call("status", 403)
+			return
+		}
+		rq := s.Request()
+		if rq.Method == "POST" {
+			sub := rq.FormValue("subsystem")
+			if sub == "app" {
+				sub = ""
+			}
+			l, err := ParseLevel(rq.FormValue("level"))
+			if err != nil {
+				s.Call("serve_plain", 400, err.Error())
+				return
+			}
+			a.SetLogLevel(sub, l)
+		}
+		s.Call("serve_plain", 200, levelsText(a))
+	}
+}
+
+// LogLevelEndpoint returns a Config registering an endpoint at the provided path for
+// viewing (GET) and changing (POST, with "subsystem" and "level" form values)
+// log levels at runtime. Requests are only served when the guard returns true;
+// a nil guard denies all requests.
+func LogLevelEndpoint(path string, guard func(state.State) bool) Config {
+	return DefaultConfig(func(a *App) error {
+		if guard == nil {
+			guard = func(state.State) bool {
+				return false
+			}
+		}
+		m := logLevelsManage(a, guard)
+		a.GET(path, m)
+		a.POST(path, m)
+		return nil
+	})
 }
@@ -0,0 +1,94 @@
+package app_test
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/log"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func TestSubsystemLevels(t *testing.T) {
+	a := txst.TxstingApp(t, "subsystem_levels", app.Store(
+		"log_level:warn",
+		"log_level_sessions:debug",
+		"log_level_access:error",
+	))
+	var logs bytes.Buffer
+	a.SwapOutput(&logs)
+	if a.LogLevel("") != log.LWarn || a.LogLevel("sessions") != log.LDebug || a.LogLevel("templates") != log.LWarn {
+		t.Errorf("log levels were not set from the Store: %v", a.LogLevels())
+	}
+	a.Subsystem("sessions").Debugf("sessions debug")
+	a.Subsystem("templates").Infof("templates info")
+	a.SetLogLevel("templates", log.LInfo)
+	a.Subsystem("templates").Infof("templates info after")
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], "[sessions] ") || !strings.HasSuffix(lines[0], "sessions debug") ||
+		!strings.HasPrefix(lines[1], "[templates] ") || !strings.HasSuffix(lines[1], "templates info after") {
+		t.Errorf("log %q did not contain exactly the messages at or above the subsystem levels", logs.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	a := txst.TxstingApp(t, "access_log")
+	var logs bytes.Buffer
+	a.SwapOutput(&logs)
+	x := expect(201, "GET", "/created", func(s state.State) {
+		s.Call("serve_plain", 201, "created")
+	}).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if l := logs.String(); !strings.Contains(l, "[access] [") || !strings.Contains(l, "GET /created 201 7 ") {
+			t.Errorf("access log %q did not record the request", l)
+		}
+	})
+	txst.SimplePerformer(t, a, x).Perform()
+}
+
+func TestLogLevelEndpoint(t *testing.T) {
+	denied := txst.TxstingApp(t, "log_levels_denied", app.LogLevelEndpoint("/levels", nil))
+	txst.SimplePerformer(t, denied, expect(403, "GET", "/levels", nil)).Perform()
+
+	a := txst.TxstingApp(t, "log_levels", app.LogLevelEndpoint("/levels", func(s state.State) bool {
+		return s.Request().Header.Get("X-Admin") == "yes"
+	}))
+	txst.MultiPerformer(t, a,
+		expect(403, "GET", "/levels", nil),
+		expect(200, "GET", "/levels", nil, "X-Admin", "yes").check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+			if !strings.Contains(rw.Body.String(), "templates: ") {
+				t.Errorf("log levels %q did not list the templates subsystem", rw.Body.String())
+			}
+		}),
+		expect(400, "POST", "/levels", nil, "X-Admin", "yes").at("/levels?subsystem=templates&level=loud"),
+		expect(200, "POST", "/levels", nil, "X-Admin", "yes").at("/levels?subsystem=templates&level=error"),
+	).Perform()
+	if a.LogLevel("templates") != log.LError {
+		t.Errorf("templates log level was %v, expected error", a.LogLevel("templates"))
+	}
+}
+
+func TestLogLevelsConcurrently(t *testing.T) {
+	a := txst.TxstingApp(t, "log_levels_concurrently")
+	a.SwapOutput(io.Discard)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.SetLogLevel("", log.LWarn)
+			a.SetLogLevel("access", log.LDebug)
+		}
+	}()
+	txst.SimplePerformer(t, a, expect(200, "GET", "/logged", func(s state.State) {
+		a.Infof("logged")
+		app.Logger(s).Infof("logged")
+	})).Perform()
+	for i := 0; i < 100; i++ {
+		txst.SimplePerformer(t, a, expect(200, "GET", "/logged", nil)).Perform()
+	}
+	<-done
+}
@@ -0,0 +1,315 @@
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RotateOptions configures rotation of a RotatingFile.
+type RotateOptions struct {
+	// MaxSize is the size in bytes after which the file is rotated, no size
+	// limit when 0.
+	MaxSize int64
+	// MaxAge is the duration after which the file is rotated, no age limit
+	// when 0.
+	MaxAge time.Duration
+	// Backups is the number of rotated files kept, all are kept when 0.
+	Backups int
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+const backupTimeFormat = "20060102-150405.000000000"
+
+// RotatingFile is an io.WriteCloser log output writing to a file rotated by
+// size and/or age, keeping a number of (optionally gzipped) generations, and
+// reopening the file on SIGHUP for compatibility with external rotation.
+type RotatingFile struct {
+	RotateOptions
+	path   string
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	wg     sync.WaitGroup
+	hup    chan os.Signal
+	closed bool
+	errMu  sync.Mutex
+	err    error
+}
+
+// NewRotatingFile opens, or creates, the file at path for appending, returning
+// a RotatingFile rotated with the provided RotateOptions.
+func NewRotatingFile(path string, o RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{RotateOptions: o, path: path}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// an existing file is aged from its last modification, so that MaxAge
+	// is not restarted by every process restart
+	r.f, r.size, r.opened = f, fi.Size(), time.Now()
+	if fi.Size() > 0 {
+		r.opened = fi.ModTime()
+	}
+	return nil
+}
+
+func (r *RotatingFile) due(n int) bool {
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(n) > r.MaxSize {
+		return true
+	}
+	return r.MaxAge > 0 && time.Since(r.opened) > r.MaxAge
+}
+
+// Write writes p to the file, rotating the file beforehand when p would exceed
+// MaxSize or the file is older than MaxAge.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.due(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate immediately rotates the file.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			return err
+		}
+		r.f = nil
+	}
+	backup := r.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(r.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if r.Compress {
+			if err := compressFile(backup); err != nil {
+				r.fail(err)
+			}
+		}
+		r.prune()
+	}()
+	return nil
+}
+
+// fail records the first error of background compression, returned by Close.
+func (r *RotatingFile) fail(err error) {
+	r.errMu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.errMu.Unlock()
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// backups lists rotated files, newest first.
+func (r *RotatingFile) backups() []string {
+	matches, _ := filepath.Glob(r.path + ".*")
+	var ret []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, r.path+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			ret = append(ret, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ret)))
+	return ret
+}
+
+func (r *RotatingFile) prune() {
+	if r.Backups <= 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, b := range r.backups() {
+		stamp := strings.TrimSuffix(b, ".gz")
+		if seen[stamp] {
+			continue
+		}
+		seen[stamp] = true
+		if len(seen) > r.Backups {
+			os.Remove(b)
+		}
+	}
+}
+
+// Reopen closes and reopens the file at its path, e.g. after the file has been
+// moved by an external log rotation.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+	return r.open()
+}
+
+// ReopenOnSIGHUP starts reopening the file on every SIGHUP received, until the
+// RotatingFile is closed.
+func (r *RotatingFile) ReopenOnSIGHUP() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hup != nil {
+		return
+	}
+	r.hup = make(chan os.Signal, 1)
+	signal.Notify(r.hup, syscall.SIGHUP)
+	go func(c chan os.Signal) {
+		for range c {
+			r.Reopen()
+		}
+	}(r.hup)
+}
+
+// Close stops any SIGHUP handling, waits for pending compression, and closes
+// the file, returning any error closing the file or of compression.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hup != nil {
+		signal.Stop(r.hup)
+		close(r.hup)
+		r.hup = nil
+	}
+	r.closed = true
+	r.wg.Wait()
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	if err == nil {
+		err = r.err
+	}
+	return err
+}
+
+func storedInt(a *App, key string, def int64) (int64, error) {
+	if v := a.String(key); v != "" {
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return def, nil
+}
+
+// LogFile returns a Config swapping the app log output for a RotatingFile,
+// configured from the Store keys "log_file"(path, the Config does nothing
+// when empty), "log_file_max_size"(bytes, default 100MB), "log_file_max_age"
+// (a time.Duration string, no default), "log_file_backups"(default 7), and
+// "log_file_compress"(default true). The file is reopened on SIGHUP, and
+// closed by App Shutdown, with log output returned to os.Stdout.
+func LogFile() Config {
+	return DefaultConfig(func(a *App) error {
+		path := a.String("log_file")
+		if path == "" {
+			return nil
+		}
+		var o RotateOptions
+		var err error
+		if o.MaxSize, err = storedInt(a, "log_file_max_size", 100<<20); err != nil {
+			return err
+		}
+		if v := a.String("log_file_max_age"); v != "" {
+			if o.MaxAge, err = time.ParseDuration(v); err != nil {
+				return err
+			}
+		}
+		backups, err := storedInt(a, "log_file_backups", 7)
+		if err != nil {
+			return err
+		}
+		o.Backups = int(backups)
+		o.Compress = a.String("log_file_compress") != "false"
+		f, err := NewRotatingFile(path, o)
+		if err != nil {
+			return err
+		}
+		f.ReopenOnSIGHUP()
+		a.SwapOutput(f)
+		a.OnShutdown(func(context.Context, *App) error {
+			a.SwapOutput(os.Stdout)
+			return f.Close()
+		})
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/txst"
+)
+
+func rotatedFiles(t *testing.T, path string) []string {
+	m, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := app.NewRotatingFile(path, app.RotateOptions{MaxSize: 10, Backups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b := rotatedFiles(t, path); len(b) != 2 {
+		t.Errorf("expected 2 rotated files, found %d: %v", len(b), b)
+	}
+	current, _ := ioutil.ReadFile(path)
+	if string(current) != "fourth\n" {
+		t.Errorf(`current log file was %q, expected "fourth\n"`, current)
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := app.NewRotatingFile(path, app.RotateOptions{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("compressed\n"))
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	b := rotatedFiles(t, path)
+	if len(b) != 1 || !strings.HasSuffix(b[0], ".gz") {
+		t.Fatalf("expected a single gzipped rotated file, found %v", b)
+	}
+	raw, _ := ioutil.ReadFile(b[0])
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(gz)
+	if string(content) != "compressed\n" {
+		t.Errorf(`rotated file content was %q, expected "compressed\n"`, content)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	f, err := app.NewRotatingFile(path, app.RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("new\n"))
+	f.Close()
+	if b := rotatedFiles(t, path); len(b) != 1 {
+		t.Errorf("an existing file older than MaxAge was not rotated, found %v", b)
+	}
+}
+
+func TestLogFileShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	a := txst.TxstingApp(t, "log_file", app.Store("log_file:"+path), app.LogFile())
+	a.Warnf("before shutdown")
+	if err := a.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.Warnf("after shutdown")
+	content, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(content), "before shutdown") || strings.Contains(string(content), "after shutdown") {
+		t.Errorf("log file %q was not closed at shutdown", content)
+	}
+}
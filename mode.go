@@ -59,6 +59,18 @@ func (m *modr) SetMode(mode string, value bool) error {
 // Given State and a string denoting a Mode, ModeIs returns a boolean value
 // for that mode. If mode string is does not exist, returns false.
 func ModeIs(s state.State, is string) bool {
-	m, _ := s.Call("mode_is", is)
-	return m.(bool)
+	if m, err := Dispatch(s, "mode_is", is); err == nil {
+		if ret, ok := m.(bool); ok {
+			return ret
+		}
+		mistyped(s, "mode_is", m, "bool")
+	}
+	return false
+}
+
+// developing reports whether the State is in Development mode and not in
+// Production mode, as Development is a default mode that Production may be
+// set alongside.
+func developing(s state.State) bool {
+	return ModeIs(s, "development") && !ModeIs(s, "production")
 }
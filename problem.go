@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/flxtilla/cxre/state"
+)
+
+// ProblemContentType is the content type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// A Problem is an error described by RFC 7807 problem details, rendered as
+// application/problem+json when passed to Abort. Extensions are additional
+// problem members, and Err an internal cause, shown only as permitted by
+// ProblemJSON.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+	Err        error
+}
+
+// NewProblem returns a Problem with the status code and detail, titled with
+// the status text of the code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With returns the Problem with the extension member key set to the value.
+func (p *Problem) With(key string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]interface{})
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) Error() string {
+	ret := strconv.Itoa(p.Status) + " " + p.Title
+	if p.Detail != "" {
+		ret += ": " + p.Detail
+	}
+	if p.Err != nil {
+		ret += ": " + p.Err.Error()
+	}
+	return ret
+}
+
+func (p *Problem) Unwrap() error {
+	return p.Err
+}
+
+// MarshalJSON encodes the Problem members, with the extension members, of
+// which those named as standard members are ignored.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	t := p.Type
+	if t == "" {
+		t = "about:blank"
+	}
+	m["type"] = t
+	m["status"] = p.Status
+	for k, v := range map[string]string{"title": p.Title, "detail": p.Detail, "instance": p.Instance} {
+		if v != "" {
+			m[k] = v
+		} else {
+			delete(m, k)
+		}
+	}
+	return json.Marshal(m)
+}
+
+func problemOf(err error) (*Problem, bool) {
+	var p *Problem
+	ok := errors.As(err, &p)
+	return p, ok
+}
+
+// problemFor returns the Problem of the AbortError, or a Problem describing
+// it, with internal details included only when exposed.
+func problemFor(s state.State, e *AbortError, exposed bool) *Problem {
+	var ret Problem
+	if p, ok := problemOf(e.Err); ok {
+		ret = *p
+		ret.Extensions = nil
+		for k, v := range p.Extensions {
+			ret.With(k, v)
+		}
+	} else {
+		ret.Detail = e.Message
+		ret.Err = e.Err
+	}
+	if ret.Status == 0 {
+		ret.Status = e.Code
+	}
+	if ret.Title == "" {
+		ret.Title = http.StatusText(ret.Status)
+	}
+	if ret.Instance == "" {
+		ret.Instance = s.Request().URL.Path
+	}
+	if exposed && ret.Err != nil {
+		ret.With("internal", ret.Err.Error())
+	}
+	if !exposed && ret.Status >= 500 {
+		ret.Detail = ""
+	}
+	return &ret
+}
+
+// ProblemJSON returns a StatusHandler responding with the problem details of
+// the aborted request as application/problem+json: a Problem passed to Abort,
+// or a Problem describing the abort. When hide is true, internal details, the
+// Err of a Problem and the Detail of server error Problems, are only included
+// in Development mode, unless also in Production mode; otherwise they are
+// always included.
+func ProblemJSON(hide bool) StatusHandler {
+	return func(s state.State, e *AbortError) {
+		p := problemFor(s, e, !hide || developing(s))
+		b, err := json.Marshal(p)
+		if err != nil {
+			b = []byte(`{"type":"about:blank","status":` + strconv.Itoa(p.Status) + `}`)
+		}
+		rw := s.RWriter()
+		rw.Header().Set("Content-Type", ProblemContentType)
+		rw.WriteHeader(p.Status)
+		rw.WriteHeaderNow()
+		rw.Write(b)
+	}
+}
+
+// Problems returns a Config responding with problem details, as ProblemJSON,
+// for requests aborted with any status code under the blueprint prefix, or in
+// the app scope for an empty or "/" prefix.
+func Problems(prefix string, hide bool) Config {
+	return HandleStatus(prefix, 0, ProblemJSON(hide))
+}
@@ -0,0 +1,90 @@
+package app_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+// problem checks the response is problem details, with the checks of the
+// decoded problem.
+func problem(checks ...func(*testing.T, map[string]interface{})) func(*testing.T, *httptest.ResponseRecorder) {
+	return func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if ct := rw.Header().Get("Content-Type"); ct != app.ProblemContentType {
+			t.Errorf("Content-Type was %q, expected %q", ct, app.ProblemContentType)
+		}
+		var p map[string]interface{}
+		if err := json.Unmarshal(rw.Body.Bytes(), &p); err != nil {
+			t.Fatalf("%q: %s", rw.Body.String(), err)
+		}
+		for _, fn := range checks {
+			fn(t, p)
+		}
+	}
+}
+
+// problems returns a Config routing the /api blueprint to managers aborting
+// with an invalid Problem, an internal error, and no code or Problem.
+func problems() app.Config {
+	return app.DefaultConfig(func(a *app.App) error {
+		api := a.NewBlueprint("/api")
+		api.GET("/invalid", func(s state.State) {
+			p := app.NewProblem(422, "name is required").With("field", "name")
+			p.Type = "https://example.com/problems/invalid"
+			app.Abort(s, 0, p)
+		})
+		api.GET("/broken", func(s state.State) {
+			app.Abort(s, 500, errors.New("database password rejected"))
+		})
+		api.GET("/unknown", func(s state.State) {
+			app.Abort(s, 0)
+		})
+		return nil
+	})
+}
+
+func internal(exposed bool) func(*testing.T, map[string]interface{}) {
+	return func(t *testing.T, p map[string]interface{}) {
+		if _, ok := p["internal"]; ok != exposed {
+			t.Errorf("internal details exposed: %t, expected %t: %v", ok, exposed, p)
+		}
+	}
+}
+
+func TestProblems(t *testing.T) {
+	a := txst.TxstingApp(t, "problems", app.Mode("Production", true), app.Problems("/api", true), problems())
+	txst.MultiPerformer(t, a,
+		expect(422, "GET", "/api/invalid", nil).check(problem(func(t *testing.T, p map[string]interface{}) {
+			if p["status"] != float64(422) || p["detail"] != "name is required" || p["field"] != "name" {
+				t.Errorf("unexpected problem %v", p)
+			}
+			if p["type"] != "https://example.com/problems/invalid" || p["instance"] != "/api/invalid" {
+				t.Errorf("unexpected problem type or instance %v", p)
+			}
+		})),
+		expect(500, "GET", "/api/broken", nil).check(problem(internal(false), func(t *testing.T, p map[string]interface{}) {
+			if p["title"] != http.StatusText(500) {
+				t.Errorf("unexpected problem %v", p)
+			}
+		})),
+		expect(500, "GET", "/api/unknown", nil).check(problem(internal(false))),
+	).Perform()
+}
+
+func TestProblemsDevelopment(t *testing.T) {
+	a := txst.TxstingApp(t, "problems_development", app.Problems("/api", true), problems())
+	txst.SimplePerformer(t, a, expect(500, "GET", "/api/broken", nil).check(problem(internal(true)))).Perform()
+}
+
+func TestAbortUnknown(t *testing.T) {
+	a := txst.TxstingApp(t, "abort_unknown")
+	txst.SimplePerformer(t, a, expect(500, "GET", "/unknown", func(s state.State) {
+		app.Abort(s, 0)
+	})).Perform()
+}
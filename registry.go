@@ -0,0 +1,361 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// Registration describes a registered extension function: its name, the name
+// of the extension.Extension providing it, its signature, and the blueprint
+// prefix it is namespaced to, or an empty string for the app scope.
+type Registration struct {
+	Name      string
+	Extension string
+	Signature string
+	Scope     string
+}
+
+// Registry is an interface for conflict checked registration, listing, and
+// precompiled dispatch of extension functions, with extension functions
+// optionally namespaced to the routes of a blueprint. A scope is the prefix
+// of the blueprint of a route, with an empty string for the app scope.
+type Registry interface {
+	ExtendChecked(...extension.Extension) error
+	Override(...extension.Extension)
+	Registered() []Registration
+	Conflicts() []error
+	Dispatcher(string) (Dispatcher, bool)
+	Namespace(string, ...extension.Extension)
+	NamespaceOverride(string, ...extension.Extension)
+	Namespaces() []string
+	Namespaced() bool
+	ScopedExtension(string) extension.Extension
+	ScopedDispatcher(string, ...string) (Dispatcher, bool)
+}
+
+var extensionConflict = xrr.NewXrror("extension function %s from %s conflicts with the function from %s").Out
+
+// A Conflict is an extension function added by Extend under the name of an
+// already registered function, replacing the function of the Replaced
+// extension. Conflicts where either function is built in only warn when the
+// App is configured, while others fail configuration.
+type Conflict struct {
+	Name      string
+	Extension string
+	Replaced  string
+	BuiltIn   bool
+}
+
+func (c Conflict) Error() string {
+	return extensionConflict(c.Name, c.Extension, c.Replaced).Error()
+}
+
+type registry struct {
+	mu        sync.Mutex
+	base      extension.Extension
+	fns       map[string]Registration
+	builtIn   map[string]bool
+	conflicts []error
+	table     atomic.Pointer[map[string]Dispatcher]
+	spaces    []*namespace
+	spaced    atomic.Bool
+	scopes    atomic.Pointer[map[string]*scope]
+}
+
+// namespace holds the extensions and functions registered for the routes of
+// blueprints under prefix.
+type namespace struct {
+	prefix string
+	xs     []extension.Extension
+	fns    map[string]Registration
+	table  map[string]Dispatcher
+}
+
+// matches reports whether the namespace applies to the blueprint prefix, i.e.
+// the blueprint prefix is, or is under, the namespace prefix.
+func (n *namespace) matches(prefix string) bool {
+	p := strings.TrimSuffix(n.prefix, "/")
+	return p == "" || prefix == p || strings.HasPrefix(prefix, p+"/")
+}
+
+// scope is the extension, and dispatch tables from most to least specific
+// namespace and finally the app, of the routes of a blueprint prefix.
+type scope struct {
+	ext    extension.Extension
+	tables []map[string]Dispatcher
+}
+
+// newRegistry returns a registry of the built in extensions, whose functions
+// are those of the provided base extension.Extension.
+func newRegistry(base extension.Extension, xs ...extension.Extension) *registry {
+	r := &registry{
+		base:    base,
+		fns:     make(map[string]Registration),
+		builtIn: map[string]bool{templateRenderExtension: true},
+	}
+	for _, x := range xs {
+		r.builtIn[x.Name()] = true
+	}
+	r.record(xs...)
+	return r
+}
+
+// registrations lists the functions of the extension, sorted by name.
+func registrations(x extension.Extension) []Registration {
+	var ret []Registration
+	for name, fn := range functionsOf(x) {
+		ret = append(ret, Registration{Name: name, Extension: x.Name(), Signature: fmt.Sprintf("%T", fn)})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// check returns an error for every function of the provided extensions
+// conflicting with a registered function, or another provided function.
+func (r *registry) check(xs ...extension.Extension) []error {
+	return r.checkIn(r.fns, xs...)
+}
+
+func (r *registry) checkIn(fns map[string]Registration, xs ...extension.Extension) []error {
+	seen := make(map[string]Registration)
+	for k, v := range fns {
+		seen[k] = v
+	}
+	var ret []error
+	for _, x := range xs {
+		for _, reg := range registrations(x) {
+			if was, ok := seen[reg.Name]; ok {
+				ret = append(ret, Conflict{
+					Name:      reg.Name,
+					Extension: reg.Extension,
+					Replaced:  was.Extension,
+					BuiltIn:   r.builtIn[reg.Extension] || r.builtIn[was.Extension],
+				})
+			}
+			seen[reg.Name] = reg
+		}
+	}
+	return ret
+}
+
+// record registers the functions of the provided extensions, replacing the
+// dispatch table with one including a Dispatcher for each function.
+func (r *registry) record(xs ...extension.Extension) {
+	table := make(map[string]Dispatcher)
+	if t := r.table.Load(); t != nil {
+		for k, v := range *t {
+			table[k] = v
+		}
+	}
+	for _, x := range xs {
+		for _, reg := range registrations(x) {
+			r.fns[reg.Name] = reg
+		}
+		for name, fn := range functionsOf(x) {
+			table[name] = dispatcherFor(fn)
+		}
+	}
+	r.table.Store(&table)
+	r.scopes.Store(nil)
+}
+
+// Dispatcher returns the precompiled Dispatcher for the named extension
+// function.
+func (r *registry) Dispatcher(name string) (Dispatcher, bool) {
+	if t := r.table.Load(); t != nil {
+		d, ok := (*t)[name]
+		return d, ok
+	}
+	return nil, false
+}
+
+func (r *registry) conflict(errs ...error) {
+	r.conflicts = append(r.conflicts, errs...)
+}
+
+// Registered lists all registered extension functions, of the app scope and
+// then of each namespace, sorted by scope and name.
+func (r *registry) Registered() []Registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ret []Registration
+	for _, reg := range r.fns {
+		ret = append(ret, reg)
+	}
+	for _, ns := range r.spaces {
+		for _, reg := range ns.fns {
+			ret = append(ret, reg)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Scope != ret[j].Scope {
+			return ret[i].Scope < ret[j].Scope
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Conflicts lists all conflicts encountered by Extend.
+func (r *registry) Conflicts() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.conflicts...)
+}
+
+func cExtensionConflicts(a *App) error {
+	for _, err := range a.Conflicts() {
+		if c, ok := err.(Conflict); ok && c.BuiltIn {
+			a.Subsystem("config").Warnf("%s", c)
+			continue
+		}
+		return err
+	}
+	return nil
+}
+
+// Namespace registers the provided extension.Extensions for the routes of
+// blueprints under the provided prefix only, overriding any functions of the
+// same name in the app scope, or in the namespaces of shorter prefixes. As
+// with Extend, a function conflicting with one already registered in the
+// namespace replaces it, and the Conflict is listed in Conflicts.
+func (r *registry) Namespace(prefix string, xs ...extension.Extension) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ns := r.namespace(prefix)
+	r.conflict(r.checkIn(ns.fns, xs...)...)
+	r.recordIn(ns, xs...)
+}
+
+// NamespaceOverride registers the provided extension.Extensions as Namespace,
+// intentionally replacing any function of the same name in the namespace.
+func (r *registry) NamespaceOverride(prefix string, xs ...extension.Extension) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordIn(r.namespace(prefix), xs...)
+}
+
+func (r *registry) namespace(prefix string) *namespace {
+	for _, ns := range r.spaces {
+		if ns.prefix == prefix {
+			return ns
+		}
+	}
+	ns := &namespace{
+		prefix: prefix,
+		fns:    make(map[string]Registration),
+		table:  make(map[string]Dispatcher),
+	}
+	r.spaces = append(r.spaces, ns)
+	r.spaced.Store(true)
+	sort.SliceStable(r.spaces, func(i, j int) bool {
+		return len(r.spaces[i].prefix) < len(r.spaces[j].prefix)
+	})
+	return ns
+}
+
+func (r *registry) recordIn(ns *namespace, xs ...extension.Extension) {
+	for _, x := range xs {
+		for _, reg := range registrations(x) {
+			reg.Scope = ns.prefix
+			ns.fns[reg.Name] = reg
+		}
+		for name, fn := range functionsOf(x) {
+			ns.table[name] = dispatcherFor(fn)
+		}
+	}
+	ns.xs = append(ns.xs, xs...)
+	r.scopes.Store(nil)
+}
+
+// Namespaces lists the prefixes of all namespaces, shortest first.
+func (r *registry) Namespaces() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ret []string
+	for _, ns := range r.spaces {
+		ret = append(ret, ns.prefix)
+	}
+	return ret
+}
+
+// Namespaced reports whether any namespace is registered, without locking.
+func (r *registry) Namespaced() bool {
+	return r.spaced.Load()
+}
+
+// scopeFor returns the scope of the routes of the blueprint prefix, built
+// once for each prefix until extensions or namespaces are added.
+func (r *registry) scopeFor(prefix string) *scope {
+	if sc := r.scopes.Load(); sc != nil {
+		if ret, ok := (*sc)[prefix]; ok {
+			return ret
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scopes := make(map[string]*scope)
+	if sc := r.scopes.Load(); sc != nil {
+		for k, v := range *sc {
+			scopes[k] = v
+		}
+	}
+	ret := &scope{ext: r.base}
+	var xs []extension.Extension
+	for _, ns := range r.spaces {
+		if ns.matches(prefix) {
+			xs = append(xs, ns.xs...)
+			ret.tables = append([]map[string]Dispatcher{ns.table}, ret.tables...)
+		}
+	}
+	if len(xs) > 0 {
+		ret.ext = extension.New("Namespace_" + prefix)
+		ret.ext.Extend(r.base)
+		ret.ext.Extend(xs...)
+	}
+	if t := r.table.Load(); t != nil {
+		ret.tables = append(ret.tables, *t)
+	}
+	scopes[prefix] = ret
+	r.scopes.Store(&scopes)
+	return ret
+}
+
+// ScopedExtension returns the extension.Extension of the app, with the
+// functions of any namespaces applying to the routes of the blueprint prefix,
+// used to make the State of requests to those routes, so that State Call,
+// Dispatch, and templates resolve namespaced functions.
+func (r *registry) ScopedExtension(prefix string) extension.Extension {
+	return r.scopeFor(prefix).ext
+}
+
+// ScopedDispatcher returns the Dispatcher for the named extension function in
+// the most specific namespace applying to the routes of the blueprint prefix,
+// falling back to namespaces of shorter prefixes and finally the app scope.
+// With several names, each scope is searched for the names in order before
+// the next.
+func (r *registry) ScopedDispatcher(prefix string, names ...string) (Dispatcher, bool) {
+	for _, table := range r.scopeFor(prefix).tables {
+		for _, name := range names {
+			if d, ok := table[name]; ok {
+				return d, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Namespace returns a Config registering the provided extension.Extensions
+// for the routes of blueprints under the provided prefix.
+func Namespace(prefix string, xs ...extension.Extension) Config {
+	return DefaultConfig(func(a *App) error {
+		a.Namespace(prefix, xs...)
+		return nil
+	})
+}
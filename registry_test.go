@@ -0,0 +1,64 @@
+package app_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func greetings(name, value string) extension.Extension {
+	return extension.New(name,
+		extension.NewFunction("greeting", func(state.State) string { return value }),
+		extension.NewFunction("farewell", func(state.State) string { return value }),
+	)
+}
+
+func TestExtensionConflicts(t *testing.T) {
+	a := app.New("extension_conflicts")
+	a.Extend(greetings("first", "hello"), greetings("second", "hi"))
+	c := a.Conflicts()
+	if len(c) != 2 {
+		t.Fatalf("expected 2 conflicts, found %v", c)
+	}
+	for i, name := range []string{"farewell", "greeting"} {
+		if cf, ok := c[i].(app.Conflict); !ok || cf.Name != name || cf.Replaced != "first" || cf.BuiltIn {
+			t.Errorf("conflict %d was %#v, expected %s replacing the function from first", i, c[i], name)
+		}
+	}
+	if err := a.ExtendChecked(greetings("third", "hey")); err == nil {
+		t.Error("a conflicting extension was added by ExtendChecked")
+	}
+	var found bool
+	for _, reg := range a.Environment.Registered() {
+		if reg.Name == "greeting" {
+			found = reg.Extension == "second"
+		}
+	}
+	if !found {
+		t.Error("the replacing function was not listed in Registered")
+	}
+}
+
+func TestBuiltInConflicts(t *testing.T) {
+	var logs bytes.Buffer
+	a := txst.TxstingApp(t, "built_in_conflicts",
+		app.NewConfig(10, func(a *app.App) error {
+			a.SwapOutput(&logs)
+			return nil
+		}),
+		app.Extend(extension.New("custom_mode", extension.NewFunction("mode_is", func(state.State, string) bool {
+			return true
+		}))),
+	)
+	if !a.Configured() {
+		t.Fatal("replacing a built in function failed configuration")
+	}
+	if l := logs.String(); !strings.Contains(l, "[config]") || !strings.Contains(l, "mode_is from custom_mode") {
+		t.Errorf("log %q did not warn of the replaced built in function", l)
+	}
+}
@@ -0,0 +1,366 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flxtilla/cxre/engine"
+	"github.com/flxtilla/cxre/log"
+	"github.com/flxtilla/cxre/state"
+)
+
+// RequestIDHeader is the header a request id is read from, or generated into
+// when absent, and echoed on the response.
+const RequestIDHeader = "X-Request-ID"
+
+type requestKey struct{}
+
+// request holds data scoped to a single http.Request, carried on the request
+// context.Context.
+type request struct {
+	app    *App
+	id     string
+	method string
+	path   string
+	mu     sync.Mutex
+	ctx    context.Context
+	done   []func()
+	result *engine.Result
+
+	routeMethod string
+	pattern     string
+	scoped      bool
+	prefix      string
+	logger      log.Logger
+
+	uploadOnce sync.Once
+	uploads    *multipart.Form
+	uploadErr  error
+}
+
+func (r *request) context() context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ctx
+}
+
+func (r *request) withValue(key, value interface{}) {
+	r.mu.Lock()
+	r.ctx = context.WithValue(r.ctx, key, value)
+	r.mu.Unlock()
+}
+
+// atFinish adds a function to be run when the request is finished.
+func (r *request) atFinish(fn func()) {
+	r.mu.Lock()
+	r.done = append(r.done, fn)
+	r.mu.Unlock()
+}
+
+// finish runs, in reverse order of addition, all functions added by atFinish.
+func (r *request) finish() {
+	r.mu.Lock()
+	done := r.done
+	r.done = nil
+	r.mu.Unlock()
+	for i := len(done) - 1; i >= 0; i-- {
+		done[i]()
+	}
+}
+
+func (r *request) setResult(rs *engine.Result) {
+	r.mu.Lock()
+	r.result = rs
+	r.mu.Unlock()
+}
+
+// params returns the route parameters of the request.
+func (r *request) params() map[string][]string {
+	r.mu.Lock()
+	rs := r.result
+	r.mu.Unlock()
+	ret := make(map[string][]string)
+	if rs != nil {
+		for _, p := range rs.Params {
+			ret[p.Key] = append(ret[p.Key], p.Value)
+		}
+	}
+	return ret
+}
+
+// handle adds the engine rule for the method and route path, as the Handle of
+// the App Blueprints, recording the route on the requests the rule matches.
+func (a *App) handle(method, path string, rl engine.Rule) {
+	a.Handle(method, path, func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result) {
+		if r := requestOf(rq); r != nil {
+			r.setRoute(method, path)
+		}
+		rl(rw, rq, rs)
+	})
+}
+
+func (r *request) setRoute(method, pattern string) {
+	r.mu.Lock()
+	r.routeMethod, r.pattern = method, pattern
+	r.scoped = false
+	r.mu.Unlock()
+}
+
+// route returns the method and pattern of the route matched by the request,
+// or empty strings.
+func (r *request) route() (string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.routeMethod, r.pattern
+}
+
+// routePrefix returns the longest prefix of the App blueprints with a route of
+// the method and pattern, found once per route.
+func routePrefix(a *App, method, pattern string) string {
+	key := method + " " + pattern
+	if p, ok := a.prefixes.Load(key); ok {
+		return p.(string)
+	}
+	var ret string
+	for _, b := range a.ListBlueprints() {
+		for _, rt := range b.Map() {
+			if rt.Method == method && rt.Path == pattern && len(b.Prefix()) > len(ret) {
+				ret = b.Prefix()
+			}
+		}
+	}
+	a.prefixes.Store(key, ret)
+	return ret
+}
+
+// scope returns the prefix of the blueprint of the route matched by the
+// request, or, for requests matching no route, of the blueprint with the
+// longest prefix containing the request path, found once per route.
+func (r *request) scope() string {
+	r.mu.Lock()
+	method, pattern, prefix, scoped := r.routeMethod, r.pattern, r.prefix, r.scoped
+	r.mu.Unlock()
+	if scoped {
+		return prefix
+	}
+	if pattern == "" {
+		prefix = blueprintFor(r.app, r.path)
+	} else {
+		prefix = routePrefix(r.app, method, pattern)
+	}
+	r.mu.Lock()
+	if r.pattern == pattern {
+		r.prefix, r.scoped = prefix, true
+	}
+	r.mu.Unlock()
+	return prefix
+}
+
+// blueprintFor returns the longest prefix of an App blueprint containing the
+// path.
+func blueprintFor(a *App, path string) string {
+	if a.Blueprints == nil {
+		return ""
+	}
+	var ret string
+	for _, b := range a.ListBlueprints() {
+		p := strings.TrimSuffix(b.Prefix(), "/")
+		if (path == p || strings.HasPrefix(path, p+"/")) && len(b.Prefix()) > len(ret) {
+			ret = b.Prefix()
+		}
+	}
+	return ret
+}
+
+// scopeOf returns the scope of the request for resolving namespaced extension
+// functions, the app scope when the App has no namespaces.
+func scopeOf(a *App, rq *http.Request) string {
+	if !a.Namespaced() {
+		return ""
+	}
+	if r := requestOf(rq); r != nil {
+		return r.scope()
+	}
+	return ""
+}
+
+func (r *request) tags() []string {
+	ret := []string{r.id, r.method}
+	if _, pattern := r.route(); pattern != "" {
+		ret = append(ret, pattern)
+	}
+	return ret
+}
+
+// log returns a log.Logger tagged with the request id, method, and route
+// pattern, created on first use.
+func (r *request) log() log.Logger {
+	tags := r.tags()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.logger == nil {
+		r.logger = r.app.Tagged(tags...)
+	}
+	return r.logger
+}
+
+// subsystem returns a log.Logger for the named subsystem, tagged as log.
+func (r *request) subsystem(name string) log.Logger {
+	return r.app.Subsystem(name, r.tags()...)
+}
+
+func requestOf(rq *http.Request) *request {
+	if r, ok := rq.Context().Value(requestKey{}).(*request); ok {
+		return r
+	}
+	return nil
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// withRequest returns the provided http.Request carrying request scoped data,
+// creating that data if the request does not already have it. The request id
+// is taken from, or set to, the RequestIDHeader and echoed on the response.
+func withRequest(a *App, rw http.ResponseWriter, rq *http.Request) *http.Request {
+	if r := requestOf(rq); r != nil {
+		return rq
+	}
+	id := rq.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+		rq.Header.Set(RequestIDHeader, id)
+	}
+	rw.Header().Set(RequestIDHeader, id)
+	r := &request{
+		app:    a,
+		id:     id,
+		method: rq.Method,
+		path:   rq.URL.Path,
+	}
+	r.ctx = context.WithValue(rq.Context(), requestKey{}, r)
+	return rq.WithContext(r.ctx)
+}
+
+// beginRequest returns the provided http.Request carrying request scoped data
+// and a cancellable context.Context, along with a function finishing the
+// request. The context is cancelled when the request finishes, the client
+// disconnects, the "request_timeout" Store duration passes, or the App is
+// shut down while the request is outstanding.
+func beginRequest(a *App, rw http.ResponseWriter, rq *http.Request) (*http.Request, func()) {
+	if r := requestOf(rq); r != nil {
+		return rq, func() {}
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if d, err := time.ParseDuration(a.String("request_timeout")); err == nil && d > 0 {
+		ctx, cancel = context.WithTimeout(rq.Context(), d)
+	} else {
+		ctx, cancel = context.WithCancel(rq.Context())
+	}
+	stop := func() bool { return false }
+	if base := a.baseContext(); base != nil {
+		stop = context.AfterFunc(base, cancel)
+	}
+	rq = withRequest(a, rw, rq.WithContext(ctx))
+	r := requestOf(rq)
+	return rq, func() {
+		r.finish()
+		stop()
+		cancel()
+	}
+}
+
+func requestIDFunc(s state.State) string {
+	if r := requestOf(s.Request()); r != nil {
+		return r.id
+	}
+	return ""
+}
+
+func loggerFunc(a *App) func(state.State) log.Logger {
+	return func(s state.State) log.Logger {
+		if r := requestOf(s.Request()); r != nil {
+			return r.log()
+		}
+		return a.Environment
+	}
+}
+
+func contextFunc(s state.State) context.Context {
+	if r := requestOf(s.Request()); r != nil {
+		return r.context()
+	}
+	return s.Request().Context()
+}
+
+func withValueFunc(s state.State, key, value interface{}) error {
+	if r := requestOf(s.Request()); r != nil {
+		r.withValue(key, value)
+	}
+	return nil
+}
+
+// Provided a State, Context returns the context.Context of the current
+// request, cancelled when the request finishes, the client disconnects, or
+// the App is shut down.
+func Context(s state.State) context.Context {
+	if c, err := Dispatch(s, "context"); err == nil {
+		if ret, ok := c.(context.Context); ok {
+			return ret
+		}
+	}
+	return s.Request().Context()
+}
+
+// Provided a State, a key, and a value, WithValue attaches the value to the
+// context.Context of the current request, as with context.WithValue.
+func WithValue(s state.State, key, value interface{}) {
+	Dispatch(s, "with_value", key, value)
+}
+
+// Provided a State, RequestID returns the id of the current request, or an
+// empty string.
+func RequestID(s state.State) string {
+	if id, err := Dispatch(s, "request_id"); err == nil {
+		if ret, ok := id.(string); ok {
+			return ret
+		}
+	}
+	return ""
+}
+
+// Provided a State, Logger returns a log.Logger tagged with the request id,
+// method, and route pattern of the current request.
+func Logger(s state.State) log.Logger {
+	if l, err := Dispatch(s, "logger"); err == nil {
+		if ret, ok := l.(log.Logger); ok {
+			return ret
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	a := txst.TxstingApp(t, "request_id")
+	a.SwapOutput(&logs)
+	var id string
+	logged := func(s state.State) {
+		id = app.RequestID(s)
+		app.Logger(s).Warnf("handled")
+	}
+
+	generated := expect(200, "GET", "/items/:item", logged).at("/items/42").check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if id == "" || rw.Header().Get(app.RequestIDHeader) != id {
+			t.Errorf("generated request id %q was not echoed, got %q", id, rw.Header().Get(app.RequestIDHeader))
+		}
+		l := strings.SplitN(logs.String(), "\n", 2)[0]
+		if !strings.Contains(l, id) || !strings.Contains(l, "/items/:item") || strings.Contains(l, "/items/42") {
+			t.Errorf("log %q was not tagged with the request id and route pattern", l)
+		}
+	})
+	echoed := expect(200, "GET", "/echo", logged, app.RequestIDHeader, "incoming-id.1").check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if id != "incoming-id.1" || rw.Header().Get(app.RequestIDHeader) != id {
+			t.Errorf(`request id was %q, echoed %q, expected "incoming-id.1"`, id, rw.Header().Get(app.RequestIDHeader))
+		}
+	})
+	replaced := expect(200, "GET", "/replaced", logged, app.RequestIDHeader, "not valid").check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if id == "" || id == "not valid" || rw.Header().Get(app.RequestIDHeader) != id {
+			t.Errorf("invalid incoming request id was not replaced, got %q", id)
+		}
+	})
+	txst.MultiPerformer(t, a, generated, echoed, replaced).Perform()
+}
+
+func cancelled(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	a := txst.TxstingApp(t, "request_context")
+	client, disconnect := context.WithCancel(context.Background())
+	var shutdown context.Context
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/disconnect", func(s state.State) {
+			disconnect()
+			if !cancelled(app.Context(s)) {
+				t.Error("request context was not cancelled on client disconnect")
+			}
+		}).within(client),
+		expect(200, "GET", "/shutdown", func(s state.State) {
+			shutdown = app.Context(s)
+			a.Shutdown(context.Background())
+		}),
+		expect(200, "GET", "/after", func(s state.State) {
+			if app.Context(s).Err() != nil {
+				t.Error("request begun after shutdown started cancelled")
+			}
+		}),
+	).Perform()
+	if !cancelled(shutdown) {
+		t.Error("outstanding request context was not cancelled on shutdown")
+	}
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+var (
+	fileNotFound   = xrr.NewXrror("file %s not found").Out
+	unsendableFile = xrr.NewXrror("cannot send %T, expected a path, []byte, io.ReadSeeker, or func(io.Writer) error").Out
+)
+
+// within reports whether the path is within the directory, following any
+// symlinks of either.
+func within(dir, p string) bool {
+	d, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	r, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(d, r)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveFile opens the named file from the comma separated
+// "static_directories" Store value, or else from the App Assets. Names with
+// parent directory segments are refused, and resolved files must remain
+// within their static directory.
+func resolveFile(a *App, name string) (http.File, error) {
+	for _, seg := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return nil, fileNotFound(name)
+		}
+	}
+	if strings.ContainsRune(name, 0) {
+		return nil, fileNotFound(name)
+	}
+	clean := path.Clean("/" + filepath.ToSlash(name))
+	for _, dir := range strings.Split(a.String("static_directories"), ",") {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		full := filepath.Join(dir, filepath.FromSlash(clean))
+		if fi, err := os.Stat(full); err != nil || fi.IsDir() || !within(dir, full) {
+			continue
+		}
+		if f, err := os.Open(full); err == nil {
+			return f, nil
+		}
+	}
+	if f, err := a.GetAsset(strings.TrimPrefix(clean, "/")); err == nil && f != nil {
+		if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+			return f, nil
+		}
+		f.Close()
+	}
+	return nil, fileNotFound(name)
+}
+
+// onceCloser is an io.Closer closed at most once.
+type onceCloser struct {
+	io.Closer
+	once sync.Once
+}
+
+func (c *onceCloser) Close() error {
+	var err error
+	c.once.Do(func() { err = c.Closer.Close() })
+	return err
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// contentDisposition returns a Content-Disposition header value of the kind,
+// with an ASCII filename, and an RFC 5987 encoded UTF-8 filename* when the
+// filename is not plain ASCII.
+func contentDisposition(kind, filename string) string {
+	if filename == "" {
+		return kind
+	}
+	var ascii strings.Builder
+	plain := true
+	for _, r := range filename {
+		switch {
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\' || r > 0x7e:
+			ascii.WriteByte('_')
+			plain = false
+		default:
+			ascii.WriteRune(r)
+		}
+	}
+	ret := kind + `; filename="` + ascii.String() + `"`
+	if plain {
+		return ret
+	}
+	var enc strings.Builder
+	for i := 0; i < len(filename); i++ {
+		c := filename[i]
+		if isAttrChar(c) {
+			enc.WriteByte(c)
+		} else {
+			fmt.Fprintf(&enc, "%%%02X", c)
+		}
+	}
+	return ret + "; filename*=UTF-8''" + enc.String()
+}
+
+// sendFile serves content: a path resolved with resolveFile, []byte, or an
+// io.ReadSeeker, with range and conditional request support, or generated
+// content written by a func(io.Writer) error. The name, or the path base when
+// no name is provided, sets the content type and Content-Disposition filename.
+// Opened files, and io.ReadSeeker content that is an io.Closer, are closed
+// when served, or when the request finishes without serving them, e.g. after
+// an abort.
+func sendFile(a *App, s state.State, src interface{}, name, disposition string) error {
+	var content io.ReadSeeker
+	var generate func(io.Writer) error
+	var closer io.Closer
+	var modtime time.Time
+	switch v := src.(type) {
+	case string:
+		f, err := resolveFile(a, v)
+		if err != nil {
+			s.Call("status", http.StatusNotFound)
+			return err
+		}
+		if fi, err := f.Stat(); err == nil {
+			modtime = fi.ModTime()
+		}
+		if name == "" {
+			name = path.Base(filepath.ToSlash(v))
+		}
+		content, closer = f, f
+	case []byte:
+		content = bytes.NewReader(v)
+	case io.ReadSeeker:
+		content = v
+		if c, ok := v.(io.Closer); ok {
+			closer = c
+		}
+		if f, ok := v.(http.File); ok {
+			if fi, err := f.Stat(); err == nil {
+				modtime = fi.ModTime()
+			}
+		}
+	case func(io.Writer) error:
+		generate = v
+	default:
+		return unsendableFile(src)
+	}
+	if closer != nil {
+		closer = &onceCloser{Closer: closer}
+		if r := requestOf(s.Request()); r != nil {
+			r.atFinish(func() { closer.Close() })
+		}
+	}
+	if disposition != "" {
+		s.RWriter().Header().Set("Content-Disposition", contentDisposition(disposition, name))
+	}
+	s.Push(func(ps state.State) {
+		rw := ps.RWriter()
+		if closer != nil {
+			defer closer.Close()
+		}
+		if generate == nil {
+			http.ServeContent(rw, ps.Request(), name, modtime, content)
+			return
+		}
+		if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+			rw.Header().Set("Content-Type", ct)
+		}
+		rw.Header().Set("Accept-Ranges", "none")
+		rw.WriteHeader(http.StatusOK)
+		generate(rw)
+	})
+	return nil
+}
+
+func sendFileFunc(a *App) func(state.State, interface{}, string) error {
+	return func(s state.State, src interface{}, name string) error {
+		return sendFile(a, s, src, name, "inline")
+	}
+}
+
+func sendDownloadFunc(a *App) func(state.State, interface{}, string) error {
+	return func(s state.State, src interface{}, name string) error {
+		return sendFile(a, s, src, name, "attachment")
+	}
+}
+
+// Provided a State, content, and a name, SendFile serves the content inline.
+// Content is a path resolved against the static directories and Assets,
+// []byte, an io.ReadSeeker served with range and conditional request support,
+// or a func(io.Writer) error generating the content. The name, defaulting to
+// the base of a path, sets the content type and filename.
+func SendFile(s state.State, src interface{}, name string) error {
+	_, err := Dispatch(s, "send_file", src, name)
+	return err
+}
+
+// Provided a State, content, and a filename, SendDownload serves the content
+// as SendFile does, as an attachment downloaded with the filename.
+func SendDownload(s state.State, src interface{}, filename string) error {
+	_, err := Dispatch(s, "send_download", src, filename)
+	return err
+}
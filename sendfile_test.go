@@ -0,0 +1,67 @@
+package app_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func TestSendDownload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report.txt"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := txst.TxstingApp(t, "send_download", app.Store("static_directories:"+dir))
+	downloads := func(s state.State) {
+		app.SendDownload(s, s.Request().URL.Query().Get("path"), "résumé.txt")
+	}
+	disposition := `attachment; filename="r_sum_.txt"; filename*=UTF-8''r%C3%A9sum%C3%A9.txt`
+	txst.MultiPerformer(t, a,
+		expect(206, "GET", "/download/:name", downloads, "Range", "bytes=2-4").
+			at("/download/report?path=report.txt").
+			check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+				if rw.Body.String() != "234" {
+					t.Errorf("expected a response of %q, got %q", "234", rw.Body.String())
+				}
+				if cd := rw.Header().Get("Content-Disposition"); cd != disposition {
+					t.Errorf("Content-Disposition was %q, expected %q", cd, disposition)
+				}
+			}),
+		expect(404, "GET", "/download/:name", nil).
+			at("/download/passwd?path=../../etc/passwd"),
+	).Perform()
+}
+
+// closingReader is an io.ReadSeeker recording whether it was closed.
+type closingReader struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (c *closingReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSendFileClosed(t *testing.T) {
+	a := txst.TxstingApp(t, "send_file_closed")
+	served, aborted := &closingReader{Reader: bytes.NewReader([]byte("served"))}, &closingReader{Reader: bytes.NewReader([]byte("aborted"))}
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/served", func(s state.State) {
+			app.SendFile(s, served, "served.txt")
+		}),
+		expect(500, "GET", "/aborted", func(s state.State) {
+			app.SendFile(s, aborted, "aborted.txt")
+			app.Abort(s, 500)
+		}),
+	).Perform()
+	if !served.closed || !aborted.closed {
+		t.Errorf("content was not closed, served: %t, aborted: %t", served.closed, aborted.closed)
+	}
+}
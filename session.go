@@ -0,0 +1,299 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/flxtilla/cxre/session"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// Session failure policies, set with the "session_failure" Store key, for
+// when a session cannot be started for a request.
+const (
+	// SessionFail fails the request with the 500 status managers. This is
+	// the default.
+	SessionFail = "fail"
+	// SessionEphemeral continues the request with an in memory session
+	// discarded when the request is finished.
+	SessionEphemeral = "ephemeral"
+	// SessionNone continues the request without a session, ignoring any
+	// session writes.
+	SessionNone = "none"
+)
+
+var (
+	nilSession           = xrr.NewXrror("session store was nil").Out
+	invalidSessionPolicy = xrr.NewXrror(`%q is not a session failure policy, expected "fail", "ephemeral", or "none"`).Out
+)
+
+func checkSessionPolicy(policy string) error {
+	switch policy {
+	case SessionFail, SessionEphemeral, SessionNone:
+		return nil
+	}
+	return invalidSessionPolicy(policy)
+}
+
+// SessionFailure returns a Config setting the "session_failure" policy,
+// failing configuration for an unknown policy.
+func SessionFailure(policy string) Config {
+	return DefaultConfig(func(a *App) error {
+		if err := checkSessionPolicy(policy); err != nil {
+			return err
+		}
+		a.Add("session_failure", policy)
+		return nil
+	})
+}
+
+// startSession starts a session for the request, returning the SessionStore
+// and, when the session fails to start and the "session_failure" policy is to
+// fail the request, the managers to run in place of the route managers.
+func startSession(a *App, rw http.ResponseWriter, rq *http.Request) (session.SessionStore, []state.Manage) {
+	ss, err := a.Start(rw, rq)
+	if err == nil && ss != nil {
+		return ss, nil
+	}
+	if err == nil {
+		err = nilSession()
+	}
+	l := a.Subsystem("sessions")
+	if r := requestOf(rq); r != nil {
+		l = r.subsystem("sessions")
+	}
+	switch a.String("session_failure") {
+	case SessionEphemeral:
+		l.Errorf("session start failed, continuing with an ephemeral session: %s", err)
+		return newEphemeralSession(), nil
+	case SessionNone:
+		l.Errorf("session start failed, continuing without a session: %s", err)
+		return noSession{}, nil
+	}
+	l.Errorf("session start failed, failing the request: %s", err)
+	return noSession{}, a.GetStatus(500).Managers()
+}
+
+// sessionFor returns the SessionStore for the State, lazily started on first
+// use unless the "session_lazy" Store key is "false", and, when an eagerly
+// started session fails with a "session_failure" policy to fail the request,
+// the managers to run in place of the route managers.
+func sessionFor(a *App, s state.State) (session.SessionStore, []state.Manage) {
+	if a.String("session_lazy") != "false" {
+		return &lazySession{a: a, s: s}, nil
+	}
+	return startSession(a, s.RWriter(), s.Request())
+}
+
+// lazySession is a SessionStore starting the underlying session on first use,
+// and releasing it, including any cookie set when starting, only when the
+// session has been modified. When the session fails to start with a policy to
+// fail the request, the State is bounced to the 500 status managers, and
+// session writes return an error.
+type lazySession struct {
+	a       *App
+	s       state.State
+	mu      sync.Mutex
+	ss      session.SessionStore
+	err     error
+	started *headerWriter
+	dirty   bool
+}
+
+var sessionFailed = xrr.NewXrror("session could not be started, the request has failed").Out
+
+func (l *lazySession) store() (session.SessionStore, error) {
+	l.mu.Lock()
+	if l.ss != nil {
+		defer l.mu.Unlock()
+		return l.ss, l.err
+	}
+	l.started = &headerWriter{header: make(http.Header)}
+	ss, failed := startSession(l.a, l.started, l.s.Request())
+	l.ss = ss
+	if failed != nil {
+		l.err = sessionFailed()
+	}
+	err := l.err
+	l.mu.Unlock()
+	if failed != nil {
+		l.s.Bounce(func(ps state.State) {
+			for _, m := range failed {
+				m(ps)
+			}
+		})
+	}
+	return ss, err
+}
+
+func (l *lazySession) modify() (session.SessionStore, error) {
+	ss, err := l.store()
+	if err == nil {
+		l.mu.Lock()
+		l.dirty = true
+		l.mu.Unlock()
+	}
+	return ss, err
+}
+
+func (l *lazySession) Set(key, value interface{}) error {
+	ss, err := l.modify()
+	if err != nil {
+		return err
+	}
+	return ss.Set(key, value)
+}
+
+func (l *lazySession) Get(key interface{}) interface{} {
+	ss, _ := l.store()
+	return ss.Get(key)
+}
+
+func (l *lazySession) Delete(key interface{}) error {
+	ss, err := l.modify()
+	if err != nil {
+		return err
+	}
+	return ss.Delete(key)
+}
+
+// cookie returns the session id sent with the request, if any.
+func (l *lazySession) cookie() string {
+	c, err := l.s.Request().Cookie(l.a.String("session_cookiename"))
+	if err != nil || c.Value == "" {
+		return ""
+	}
+	id, err := url.QueryUnescape(c.Value)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// SessionID returns the id of a started session, or else the session id sent
+// with the request, without starting the session.
+func (l *lazySession) SessionID() string {
+	l.mu.Lock()
+	ss := l.ss
+	l.mu.Unlock()
+	if ss != nil {
+		return ss.SessionID()
+	}
+	return l.cookie()
+}
+
+// SessionRelease releases a started and modified session, adding any headers
+// set when the session was started to the provided http.ResponseWriter.
+func (l *lazySession) SessionRelease(w http.ResponseWriter) {
+	l.mu.Lock()
+	ss, started, dirty := l.ss, l.started, l.dirty
+	l.mu.Unlock()
+	if ss == nil || !dirty {
+		return
+	}
+	for k, v := range started.header {
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	ss.SessionRelease(w)
+}
+
+// Flush clears the session, without starting a session when none was sent
+// with the request.
+func (l *lazySession) Flush() error {
+	l.mu.Lock()
+	started := l.ss != nil
+	l.mu.Unlock()
+	if !started && l.cookie() == "" {
+		return nil
+	}
+	ss, err := l.modify()
+	if err != nil {
+		return err
+	}
+	return ss.Flush()
+}
+
+// headerWriter is an http.ResponseWriter capturing headers only.
+type headerWriter struct {
+	header http.Header
+}
+
+func (h *headerWriter) Header() http.Header {
+	return h.header
+}
+
+func (h *headerWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (h *headerWriter) WriteHeader(int) {}
+
+type ephemeralSession struct {
+	mu     sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+func newEphemeralSession() *ephemeralSession {
+	return &ephemeralSession{values: make(map[interface{}]interface{})}
+}
+
+func (e *ephemeralSession) Set(key, value interface{}) error {
+	e.mu.Lock()
+	e.values[key] = value
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *ephemeralSession) Get(key interface{}) interface{} {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.values[key]
+}
+
+func (e *ephemeralSession) Delete(key interface{}) error {
+	e.mu.Lock()
+	delete(e.values, key)
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *ephemeralSession) SessionID() string {
+	return ""
+}
+
+func (e *ephemeralSession) SessionRelease(w http.ResponseWriter) {}
+
+func (e *ephemeralSession) Flush() error {
+	e.mu.Lock()
+	e.values = make(map[interface{}]interface{})
+	e.mu.Unlock()
+	return nil
+}
+
+type noSession struct{}
+
+func (noSession) Set(key, value interface{}) error {
+	return nil
+}
+
+func (noSession) Get(key interface{}) interface{} {
+	return nil
+}
+
+func (noSession) Delete(key interface{}) error {
+	return nil
+}
+
+func (noSession) SessionID() string {
+	return ""
+}
+
+func (noSession) SessionRelease(w http.ResponseWriter) {}
+
+func (noSession) Flush() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package app_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/session"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+// failingSessions is an app Environment whose sessions fail to start.
+type failingSessions struct {
+	app.Environment
+}
+
+func (failingSessions) Start(http.ResponseWriter, *http.Request) (session.SessionStore, error) {
+	return nil, errors.New("session backend unavailable")
+}
+
+var failSessions = app.DefaultConfig(func(a *app.App) error {
+	a.Environment = failingSessions{a.Environment}
+	return nil
+})
+
+func TestSessionFailure(t *testing.T) {
+	for _, c := range []struct {
+		policy, logged string
+		code           int
+		value          interface{}
+	}{
+		{"", "failing the request", 500, nil},
+		{app.SessionEphemeral, "continuing with an ephemeral session", 200, "set"},
+		{app.SessionNone, "continuing without a session", 200, nil},
+	} {
+		conf := []app.Config{app.Store("session_lazy:false"), failSessions}
+		if c.policy != "" {
+			conf = append(conf, app.SessionFailure(c.policy))
+		}
+		a := txst.TxstingApp(t, "session_failure_"+c.policy, conf...)
+		var logs bytes.Buffer
+		a.SwapOutput(&logs)
+		var value interface{}
+		var id string
+		x := expect(c.code, "GET", "/session", func(s state.State) {
+			id = app.RequestID(s)
+			s.Set("key", "set")
+			value = s.Get("key")
+		}).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+			if value != c.value {
+				t.Errorf("%q policy: session value was %v, expected %v", c.policy, value, c.value)
+			}
+			if id == "" {
+				id = rw.Header().Get(app.RequestIDHeader)
+			}
+			l := logs.String()
+			if !strings.Contains(l, "[sessions] ["+id) || !strings.Contains(l, c.logged) {
+				t.Errorf("%q policy: log %q did not report the failure with the request id", c.policy, l)
+			}
+		})
+		txst.SimplePerformer(t, a, x).Perform()
+	}
+}
+
+func TestSessionFailurePolicy(t *testing.T) {
+	a := app.Base("session_failure_policy")
+	if err := app.SessionFailure("retry").Configure(a); err == nil {
+		t.Error("an unknown session failure policy was accepted")
+	}
+	if err := app.SessionFailure(app.SessionNone).Configure(a); err != nil || a.String("session_failure") != app.SessionNone {
+		t.Errorf("session failure policy was not set: %v", err)
+	}
+}
+
+func TestLazySession(t *testing.T) {
+	a := txst.TxstingApp(t, "lazy_session")
+	noCookie := func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if c := rw.Header().Get("Set-Cookie"); c != "" {
+			t.Errorf("an unmodified session set a cookie: %q", c)
+		}
+	}
+	var id string
+	txst.MultiPerformer(t, a,
+		expect(200, "GET", "/untouched", func(s state.State) {
+			s.Call("serve_plain", 200, "untouched")
+		}).check(noCookie),
+		expect(200, "GET", "/read", func(s state.State) {
+			s.Call("serve_plain", 200, fmt.Sprintf("%v", s.Get("key")))
+		}).check(noCookie),
+		expect(200, "GET", "/id", func(s state.State) {
+			id = s.SessionID()
+		}, "Cookie", "session=existing").check(noCookie).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+			if id != "existing" {
+				t.Errorf(`session id was %q, expected the request session id "existing"`, id)
+			}
+		}),
+		expect(200, "GET", "/flushed", func(s state.State) {
+			s.Flush()
+		}).check(noCookie),
+		expect(200, "GET", "/modified", func(s state.State) {
+			s.Set("key", "value")
+			s.Call("serve_plain", 200, "modified")
+		}).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+			if c := rw.Header().Values("Set-Cookie"); len(c) != 1 || !strings.HasPrefix(c[0], "session=") {
+				t.Errorf("a modified session set cookies %q, expected one session cookie", c)
+			}
+		}),
+	).Perform()
+}
+
+func TestLazySessionFailure(t *testing.T) {
+	a := txst.TxstingApp(t, "lazy_session_failure", failSessions)
+	a.SwapOutput(&bytes.Buffer{})
+	var err error
+	x := expect(500, "GET", "/fail", func(s state.State) {
+		s.Get("key")
+		err = s.Set("key", "value")
+	}).check(func(t *testing.T, rw *httptest.ResponseRecorder) {
+		if err == nil {
+			t.Error("a session write after a failed session start did not return an error")
+		}
+	})
+	txst.SimplePerformer(t, a, x).Perform()
+}
@@ -2,8 +2,13 @@ package app
 
 import (
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/flxtilla/cxre/engine"
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/session"
 	"github.com/flxtilla/cxre/state"
 )
 
@@ -11,15 +16,44 @@ import (
 // state.Make function.
 type StateMakerFn func(a *App) state.Make
 
+// A StateWrapFn is a function type decorating a state.Make function, e.g. to
+// enrich State made by the wrapped function.
+type StateWrapFn func(state.Make) state.Make
+
 // Statr is an interface providing a StateMakerFn to the app in addition to
-// functionality to change this function as needed.
+// functionality to change this function as needed, or to decorate it with
+// any number of ordered StateWrapFn.
 type Statr interface {
 	StateFunction(a *App) state.Make
 	SwapStateFunction(StateMakerFn)
+	WrapStateFunction(StateWrapFn)
+	WrapStateFunctionOrdered(int, StateWrapFn)
+}
+
+type stateWrap struct {
+	order int
+	fn    StateWrapFn
+}
+
+type stateWrapList []stateWrap
+
+func (s stateWrapList) Len() int {
+	return len(s)
+}
+
+func (s stateWrapList) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s stateWrapList) Less(i, j int) bool {
+	return s[i].order < s[j].order
 }
 
 type defaultStatr struct {
-	fn StateMakerFn
+	fn    StateMakerFn
+	wraps stateWrapList
+	mu    sync.Mutex
+	made  atomic.Pointer[state.Make]
 }
 
 // The default flotilla Statr.
@@ -29,24 +63,151 @@ func DefaultStatr() Statr {
 	}
 }
 
+// PooledStatr returns a Statr reusing State from a sync.Pool, returning State
+// to the pool when the request is finished. A pooled State must not be used
+// after its request finishes, e.g. by goroutines of hijacked or streaming
+// responses, which should use the default Statr instead.
+func PooledStatr() Statr {
+	return &defaultStatr{
+		fn: pooledStateMakerFunction,
+	}
+}
+
+// PooledState returns a Config swapping the App StateMakerFn for one reusing
+// State from a sync.Pool, as PooledStatr.
+func PooledState() Config {
+	return DefaultConfig(func(a *App) error {
+		a.SwapStateFunction(pooledStateMakerFunction)
+		return nil
+	})
+}
+
+// setUp readies the State for the request, setting the session, and returns
+// the request carrying request scoped data.
+func setUp(a *App, s state.State, ss *session.SessionStore, rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) *http.Request {
+	rq = withRequest(a, rw, rq)
+	requestOf(rq).setResult(rs)
+	s.Reset(rq, rw, m)
+	store, failed := sessionFor(a, s)
+	if failed != nil {
+		s.Reset(rq, rw, failed)
+	}
+	*ss = store
+	s.In(s)
+	return rq
+}
+
+// extensionFor returns the extension.Extension of State made for the request
+// scope, with the functions of any namespaces applying to the request route.
+func extensionFor(a *App, sc string) extension.Extension {
+	if sc != "" {
+		return a.ScopedExtension(sc)
+	}
+	return a.Environment
+}
+
 func defaultStateMakerFunction(a *App) state.Make {
 	return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
-		s := state.New(a.Environment, rs, a.Environment)
-		s.Reset(rq, rw, m)
-		s.SessionStore, _ = a.Start(s.RWriter(), s.Request())
-		s.In(s)
+		rq = withRequest(a, rw, rq)
+		s := state.New(extensionFor(a, scopeOf(a, rq)), rs, a.Environment)
+		setUp(a, s, &s.SessionStore, rw, rq, rs, m)
 		return s
 	}
 }
 
+// pooledState is a State held by a sync.Pool, with its per request fields.
+type pooledState struct {
+	state.State
+	session *session.SessionStore
+	result  **engine.Result
+}
+
+func pooledStateMakerFunction(a *App) state.Make {
+	var pools sync.Map
+	return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
+		rq = withRequest(a, rw, rq)
+		sc := scopeOf(a, rq)
+		v, ok := pools.Load(sc)
+		if !ok {
+			v, _ = pools.LoadOrStore(sc, &sync.Pool{New: func() interface{} {
+				s := state.New(extensionFor(a, sc), nil, a.Environment)
+				return &pooledState{s, &s.SessionStore, &s.Result}
+			}})
+		}
+		p := v.(*sync.Pool)
+		ps := p.Get().(*pooledState)
+		*ps.result = rs
+		rq = setUp(a, ps.State, ps.session, rw, rq, rs, m)
+		requestOf(rq).atFinish(func() {
+			*ps.session = nil
+			*ps.result = nil
+			ps.Reset(nil, nil, nil)
+			p.Put(ps)
+		})
+		return ps.State
+	}
+}
+
 // The default statr StateFunction taking an App instance and returning a
-// state.Make function.
+// state.Make function. The returned function always defers to the current
+// StateMakerFn, so that a swapped function applies to all existing routes.
 func (d *defaultStatr) StateFunction(a *App) state.Make {
-	return d.fn(a)
+	return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
+		return d.current(a)(rw, rq, rs, m)
+	}
+}
+
+func (d *defaultStatr) current(a *App) state.Make {
+	if mk := d.made.Load(); mk != nil {
+		return *mk
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if mk := d.made.Load(); mk != nil {
+		return *mk
+	}
+	mk := d.fn(a)
+	for _, w := range d.wraps {
+		mk = w.fn(mk)
+	}
+	d.made.Store(&mk)
+	return mk
 }
 
 // The default statr SwapStateFunction for changing the statr StateMaker
-// function.
+// function, for all routes including those already registered, as the App
+// Blueprints hold the state.Make function of the Statr from Base onwards. Any
+// StateWrapFn are retained, and wrap the new function.
 func (d *defaultStatr) SwapStateFunction(fn StateMakerFn) {
+	d.mu.Lock()
 	d.fn = fn
+	d.made.Store(nil)
+	d.mu.Unlock()
+}
+
+// The default statr WrapStateFunction, adding a StateWrapFn with a default
+// order of 50.
+func (d *defaultStatr) WrapStateFunction(fn StateWrapFn) {
+	d.WrapStateFunctionOrdered(50, fn)
+}
+
+// The default statr WrapStateFunctionOrdered, adding a StateWrapFn with the
+// provided order. StateWrapFn are applied from lowest to highest order, with
+// lower orders wrapping nearer the StateMakerFn and highest order outermost.
+// StateWrapFn of equal order are applied in the order they were added.
+func (d *defaultStatr) WrapStateFunctionOrdered(order int, fn StateWrapFn) {
+	d.mu.Lock()
+	d.wraps = append(d.wraps, stateWrap{order, fn})
+	sort.Stable(d.wraps)
+	d.made.Store(nil)
+	d.mu.Unlock()
+}
+
+// WrapState returns a Config adding a StateWrapFn with the provided order to
+// the App Statr.
+func WrapState(order int, fn StateWrapFn) Config {
+	return DefaultConfig(func(a *App) error {
+		a.WrapStateFunctionOrdered(order, fn)
+		return nil
+	})
 }
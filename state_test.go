@@ -0,0 +1,90 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/engine"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+func benchmarkState(b *testing.B, conf ...app.Config) {
+	conf = append(conf, app.Mode("Testing", true))
+	a := app.New("benchmark_state", conf...)
+	a.GET("/json", func(s state.State) {
+		s.Call("serve_plain", 200, `{"ok":true}`)
+	})
+	if err := a.Configure(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq, _ := http.NewRequest("GET", "/json", nil)
+		a.ServeHTTP(httptest.NewRecorder(), rq)
+	}
+}
+
+func BenchmarkDefaultState(b *testing.B) {
+	benchmarkState(b)
+}
+
+func BenchmarkPooledState(b *testing.B) {
+	benchmarkState(b, app.PooledState())
+}
+
+func TestSwapStateFunction(t *testing.T) {
+	a := txst.TxstingApp(t, "swap_state")
+	a.GET("/registered", func(s state.State) {
+		s.Call("serve_plain", 200, "registered")
+	})
+	var swapped bool
+	a.SwapStateFunction(func(a *app.App) state.Make {
+		mk := app.DefaultStatr().StateFunction(a)
+		return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
+			swapped = true
+			return mk(rw, rq, rs, m)
+		}
+	})
+	txst.SimplePerformer(t, a, expect(200, "GET", "/registered", nil)).Perform()
+	if !swapped {
+		t.Error("swapped StateMakerFn did not apply to an already registered route")
+	}
+}
+
+func recordWrap(calls *[]string, name string) app.StateWrapFn {
+	return func(mk state.Make) state.Make {
+		return func(rw http.ResponseWriter, rq *http.Request, rs *engine.Result, m []state.Manage) state.State {
+			*calls = append(*calls, name)
+			return mk(rw, rq, rs, m)
+		}
+	}
+}
+
+func TestWrapStateFunction(t *testing.T) {
+	var calls []string
+	a := txst.TxstingApp(t, "wrap_state",
+		app.PooledState(),
+		app.WrapState(20, recordWrap(&calls, "20")),
+		app.WrapState(10, recordWrap(&calls, "10")),
+		app.WrapState(20, recordWrap(&calls, "20 added later")),
+	)
+	a.WrapStateFunction(recordWrap(&calls, "default"))
+	var seen []string
+	m := func(s state.State) {
+		seen = append(seen, s.Request().URL.Path)
+		s.Call("serve_plain", 200, "wrapped")
+	}
+	txst.MultiPerformer(t, a, expect(200, "GET", "/first", m), expect(200, "GET", "/second", m)).Perform()
+	expected := "default,20 added later,20,10,default,20 added later,20,10"
+	if got := strings.Join(calls, ","); got != expected {
+		t.Errorf("StateWrapFn were called in order %q, expected %q", got, expected)
+	}
+	if strings.Join(seen, ",") != "/first,/second" {
+		t.Errorf("pooled State served %v, expected each request in turn", seen)
+	}
+}
@@ -0,0 +1,251 @@
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// Info describes an upload.
+type Info struct {
+	ID       string
+	Size     int64
+	Offset   int64
+	Metadata map[string]string
+	Expires  time.Time
+}
+
+// Complete reports whether all bytes of the upload have been received.
+func (i Info) Complete() bool {
+	return i.Offset == i.Size
+}
+
+// Backend is an interface for storage of uploads. Write fails with an error
+// matching ErrOffsetMismatch for an offset other than the upload offset, and
+// with an error matching ErrNotFound for expired uploads.
+type Backend interface {
+	Create(Info) (Info, error)
+	Info(string) (Info, error)
+	Write(string, int64, io.Reader) (Info, error)
+	Open(string) (io.ReadCloser, error)
+	Terminate(string) error
+	Expire(time.Time) error
+}
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	notFound          = xrr.NewXrror("upload %s not found").Out
+	offsetMismatch    = xrr.NewXrror("upload %s is at offset %d, not %d").Out
+)
+
+// matching is an error matching a sentinel error with errors.Is.
+type matching struct {
+	error
+	is error
+}
+
+func (m matching) Is(target error) bool {
+	return target == m.is
+}
+
+// NotFound returns an error, matching ErrNotFound, for the upload id.
+func NotFound(id string) error {
+	return matching{notFound(id), ErrNotFound}
+}
+
+// OffsetMismatch returns an error, matching ErrOffsetMismatch, for a write to
+// the upload id, at the offset, of an upload at another offset.
+func OffsetMismatch(id string, at, offset int64) error {
+	return matching{offsetMismatch(id, at, offset), ErrOffsetMismatch}
+}
+
+// FileBackend is a Backend storing uploads in a local filesystem directory,
+// as a data file and a JSON info file per upload.
+type FileBackend struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[string]*idLock
+}
+
+// idLock is the lock of an upload, held in the FileBackend only while in use.
+type idLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewFileBackend returns a FileBackend storing uploads in the provided
+// directory, creating the directory if needed.
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileBackend{dir: dir, locks: make(map[string]*idLock)}, nil
+}
+
+// lock locks the upload id, returning a func unlocking it, and removing the
+// lock once no other writer waits on it.
+func (f *FileBackend) lock(id string) func() {
+	f.mu.Lock()
+	l, ok := f.locks[id]
+	if !ok {
+		l = &idLock{}
+		f.locks[id] = l
+	}
+	l.refs++
+	f.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		f.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(f.locks, id)
+		}
+		f.mu.Unlock()
+	}
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (f *FileBackend) dataPath(id string) string {
+	return filepath.Join(f.dir, id+".bin")
+}
+
+func (f *FileBackend) infoPath(id string) string {
+	return filepath.Join(f.dir, id+".info")
+}
+
+func (f *FileBackend) readInfo(id string) (Info, error) {
+	var i Info
+	if !validID(id) {
+		return i, NotFound(id)
+	}
+	b, err := os.ReadFile(f.infoPath(id))
+	if os.IsNotExist(err) {
+		return i, NotFound(id)
+	}
+	if err != nil {
+		return i, err
+	}
+	err = json.Unmarshal(b, &i)
+	return i, err
+}
+
+func (f *FileBackend) writeInfo(i Info) error {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	tmp := f.infoPath(i.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.infoPath(i.ID))
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Create creates a new, empty upload, assigning the upload an ID.
+func (f *FileBackend) Create(i Info) (Info, error) {
+	i.ID = newID()
+	i.Offset = 0
+	data, err := os.OpenFile(f.dataPath(i.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return i, err
+	}
+	data.Close()
+	return i, f.writeInfo(i)
+}
+
+// Info returns the Info of the upload with the provided ID.
+func (f *FileBackend) Info(id string) (Info, error) {
+	return f.readInfo(id)
+}
+
+// Write appends bytes from the provided io.Reader to the upload, at most up to
+// the upload size, returning the updated Info. Bytes written before any read
+// error are retained, so that an interrupted upload may be resumed.
+func (f *FileBackend) Write(id string, offset int64, r io.Reader) (Info, error) {
+	unlock := f.lock(id)
+	defer unlock()
+	i, err := f.readInfo(id)
+	if err != nil {
+		return i, err
+	}
+	if !i.Expires.IsZero() && i.Expires.Before(time.Now()) {
+		return i, NotFound(id)
+	}
+	if i.Offset != offset {
+		return i, OffsetMismatch(id, i.Offset, offset)
+	}
+	data, err := os.OpenFile(f.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return i, err
+	}
+	n, err := io.Copy(data, io.LimitReader(r, i.Size-i.Offset))
+	if cerr := data.Close(); err == nil {
+		err = cerr
+	}
+	i.Offset += n
+	if werr := f.writeInfo(i); err == nil {
+		err = werr
+	}
+	return i, err
+}
+
+// Open opens the data of the upload with the provided ID for reading.
+func (f *FileBackend) Open(id string) (io.ReadCloser, error) {
+	if _, err := f.readInfo(id); err != nil {
+		return nil, err
+	}
+	return os.Open(f.dataPath(id))
+}
+
+// Terminate removes the upload with the provided ID.
+func (f *FileBackend) Terminate(id string) error {
+	if !validID(id) {
+		return NotFound(id)
+	}
+	unlock := f.lock(id)
+	defer unlock()
+	err := os.Remove(f.infoPath(id))
+	if os.IsNotExist(err) {
+		return NotFound(id)
+	}
+	os.Remove(f.dataPath(id))
+	return err
+}
+
+// Expire removes all uploads expiring before the provided time.
+func (f *FileBackend) Expire(before time.Time) error {
+	matches, err := filepath.Glob(filepath.Join(f.dir, "*.info"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		id := strings.TrimSuffix(filepath.Base(m), ".info")
+		if i, err := f.readInfo(id); err == nil && !i.Expires.IsZero() && i.Expires.Before(before) {
+			f.Terminate(id)
+		}
+	}
+	return nil
+}
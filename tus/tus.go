@@ -0,0 +1,291 @@
+// Package tus provides resumable uploads for flotilla apps, as an upload
+// endpoint compatible with the tus 1.0.0 protocol, supporting the creation,
+// expiration, and termination extensions.
+package tus
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/blueprint"
+	"github.com/flxtilla/cxre/state"
+)
+
+const (
+	// Version is the supported tus protocol version.
+	Version = "1.0.0"
+	// Extensions lists the supported tus protocol extensions.
+	Extensions = "creation,expiration,termination"
+)
+
+// Options configures a tus upload endpoint. Zero values are filled from the
+// Store keys "tus_directory"(the directory of a FileBackend, default a "tus"
+// directory in the system temporary directory), "tus_max_size"(bytes,
+// default the "upload_size"), and "tus_expiration"(a time.Duration string,
+// default 24h).
+type Options struct {
+	Backend    Backend
+	MaxSize    int64
+	Expiration time.Duration
+	// OnComplete, if not nil, is called with the State of the request
+	// completing an upload, and the Info of the completed upload.
+	OnComplete func(state.State, Info)
+}
+
+func (o *Options) fill(a *app.App) error {
+	if o.Backend == nil {
+		dir := a.String("tus_directory")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "tus")
+		}
+		b, err := NewFileBackend(dir)
+		if err != nil {
+			return err
+		}
+		o.Backend = b
+	}
+	if o.MaxSize <= 0 {
+		for _, k := range []string{"tus_max_size", "upload_size"} {
+			if v, err := strconv.ParseInt(a.String(k), 10, 64); err == nil && v > 0 {
+				o.MaxSize = v
+				break
+			}
+		}
+	}
+	if o.Expiration <= 0 {
+		o.Expiration = 24 * time.Hour
+		if v := a.String("tus_expiration"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			o.Expiration = d
+		}
+	}
+	return nil
+}
+
+type endpoint struct {
+	Options
+	prefix string
+	mu     sync.Mutex
+	swept  time.Time
+}
+
+// Config returns an app.Config mounting a tus upload endpoint blueprint at the
+// provided prefix: OPTIONS and POST at the prefix, and HEAD, PATCH, and
+// DELETE for each upload at the prefix followed by the upload id.
+func Config(prefix string, o Options) app.Config {
+	return app.DefaultConfig(func(a *app.App) error {
+		if err := o.fill(a); err != nil {
+			return err
+		}
+		prefix = strings.TrimSuffix(prefix, "/")
+		e := &endpoint{Options: o, prefix: prefix}
+		b := blueprint.New(prefix)
+		b.OPTIONS("", e.options)
+		b.POST("", e.create)
+		b.HEAD("/:id", e.head)
+		b.PATCH("/:id", e.patch)
+		b.DELETE("/:id", e.terminate)
+		return a.Mount("/", b)
+	})
+}
+
+func respond(s state.State, code int, headers ...string) {
+	w := s.RWriter()
+	w.Header().Set("Tus-Resumable", Version)
+	for i := 0; i+1 < len(headers); i += 2 {
+		w.Header().Set(headers[i], headers[i+1])
+	}
+	w.WriteHeader(code)
+	w.WriteHeaderNow()
+}
+
+// resumable checks the request Tus-Resumable header, responding with 412 when
+// the version is not supported.
+func resumable(s state.State) bool {
+	if s.Request().Header.Get("Tus-Resumable") != Version {
+		respond(s, http.StatusPreconditionFailed, "Tus-Version", Version)
+		return false
+	}
+	return true
+}
+
+func (e *endpoint) id(s state.State) string {
+	return strings.TrimPrefix(s.Request().URL.Path, e.prefix+"/")
+}
+
+func expires(i Info) string {
+	return i.Expires.UTC().Format(http.TimeFormat)
+}
+
+func (e *endpoint) get(s state.State) (Info, bool) {
+	i, err := e.Backend.Info(e.id(s))
+	if err != nil || (!i.Expires.IsZero() && i.Expires.Before(time.Now())) {
+		respond(s, http.StatusNotFound)
+		return i, false
+	}
+	return i, true
+}
+
+// sweep removes expired uploads, at most once a minute.
+func (e *endpoint) sweep() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Since(e.swept) < time.Minute {
+		return
+	}
+	e.swept = time.Now()
+	go e.Backend.Expire(e.swept)
+}
+
+func (e *endpoint) options(s state.State) {
+	respond(s, http.StatusNoContent,
+		"Tus-Version", Version,
+		"Tus-Extension", Extensions,
+		"Tus-Max-Size", strconv.FormatInt(e.MaxSize, 10),
+	)
+}
+
+func parseMetadata(header string) map[string]string {
+	ret := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.Fields(pair)
+		if len(kv) == 0 {
+			continue
+		}
+		var value string
+		if len(kv) > 1 {
+			if v, err := base64.StdEncoding.DecodeString(kv[1]); err == nil {
+				value = string(v)
+			}
+		}
+		ret[kv[0]] = value
+	}
+	return ret
+}
+
+func formatMetadata(m map[string]string) string {
+	var ret []string
+	for k, v := range m {
+		ret = append(ret, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return strings.Join(ret, ",")
+}
+
+func (e *endpoint) create(s state.State) {
+	if !resumable(s) {
+		return
+	}
+	e.sweep()
+	rq := s.Request()
+	size, err := strconv.ParseInt(rq.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		respond(s, http.StatusBadRequest)
+		return
+	}
+	if e.MaxSize > 0 && size > e.MaxSize {
+		respond(s, http.StatusRequestEntityTooLarge)
+		return
+	}
+	i, err := e.Backend.Create(Info{
+		Size:     size,
+		Metadata: parseMetadata(rq.Header.Get("Upload-Metadata")),
+		Expires:  time.Now().Add(e.Expiration),
+	})
+	if err != nil {
+		respond(s, http.StatusInternalServerError)
+		return
+	}
+	if i.Complete() && e.OnComplete != nil {
+		e.OnComplete(s, i)
+	}
+	respond(s, http.StatusCreated,
+		"Location", e.prefix+"/"+i.ID,
+		"Upload-Expires", expires(i),
+	)
+}
+
+func (e *endpoint) head(s state.State) {
+	if !resumable(s) {
+		return
+	}
+	i, ok := e.get(s)
+	if !ok {
+		return
+	}
+	headers := []string{
+		"Cache-Control", "no-store",
+		"Upload-Offset", strconv.FormatInt(i.Offset, 10),
+		"Upload-Length", strconv.FormatInt(i.Size, 10),
+		"Upload-Expires", expires(i),
+	}
+	if len(i.Metadata) > 0 {
+		headers = append(headers, "Upload-Metadata", formatMetadata(i.Metadata))
+	}
+	respond(s, http.StatusOK, headers...)
+}
+
+func (e *endpoint) patch(s state.State) {
+	if !resumable(s) {
+		return
+	}
+	rq := s.Request()
+	if rq.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respond(s, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(rq.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respond(s, http.StatusBadRequest)
+		return
+	}
+	i, ok := e.get(s)
+	if !ok {
+		return
+	}
+	if i.Offset != offset {
+		respond(s, http.StatusConflict)
+		return
+	}
+	wasComplete := i.Complete()
+	i, err = e.Backend.Write(i.ID, offset, rq.Body)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		respond(s, http.StatusNotFound)
+		return
+	case errors.Is(err, ErrOffsetMismatch):
+		respond(s, http.StatusConflict)
+		return
+	case err != nil && i.Offset == offset:
+		respond(s, http.StatusInternalServerError)
+		return
+	}
+	if !wasComplete && i.Complete() && e.OnComplete != nil {
+		e.OnComplete(s, i)
+	}
+	respond(s, http.StatusNoContent,
+		"Upload-Offset", strconv.FormatInt(i.Offset, 10),
+		"Upload-Expires", expires(i),
+	)
+}
+
+func (e *endpoint) terminate(s state.State) {
+	if !resumable(s) {
+		return
+	}
+	if err := e.Backend.Terminate(e.id(s)); err != nil {
+		respond(s, http.StatusNotFound)
+		return
+	}
+	respond(s, http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package tus_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/app/tus"
+	"github.com/flxtilla/cxre/state"
+)
+
+func tusRequest(t *testing.T, a *app.App, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	rq, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rq.Header.Set("Tus-Resumable", tus.Version)
+	for i := 0; i+1 < len(headers); i += 2 {
+		rq.Header.Set(headers[i], headers[i+1])
+	}
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, rq)
+	return rw
+}
+
+func TestUpload(t *testing.T) {
+	backend, err := tus.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var completed tus.Info
+	a := app.New(
+		"tus",
+		app.Mode("Testing", true),
+		tus.Config("/files", tus.Options{
+			Backend:    backend,
+			OnComplete: func(s state.State, i tus.Info) { completed = i },
+		}),
+	)
+	if err := a.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := tusRequest(t, a, "POST", "/files", "", "Upload-Length", "11", "Upload-Metadata", "filename aGVsbG8udHh0")
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("creation status was %d, expected 201", rw.Code)
+	}
+	location := rw.Header().Get("Location")
+
+	rw = tusRequest(t, a, "PATCH", location, "hello ", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0")
+	if rw.Code != http.StatusNoContent || rw.Header().Get("Upload-Offset") != "6" {
+		t.Fatalf("first patch was %d at offset %s, expected 204 at offset 6", rw.Code, rw.Header().Get("Upload-Offset"))
+	}
+
+	rw = tusRequest(t, a, "PATCH", location, "world", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0")
+	if rw.Code != http.StatusConflict {
+		t.Errorf("patch at a stale offset was %d, expected 409", rw.Code)
+	}
+
+	rw = tusRequest(t, a, "HEAD", location, "")
+	if rw.Header().Get("Upload-Offset") != "6" || rw.Header().Get("Upload-Length") != "11" {
+		t.Errorf("head offset and length were %s and %s, expected 6 and 11", rw.Header().Get("Upload-Offset"), rw.Header().Get("Upload-Length"))
+	}
+
+	tusRequest(t, a, "PATCH", location, "world", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "6")
+	if !completed.Complete() || completed.Metadata["filename"] != "hello.txt" {
+		t.Fatalf("upload was not completed as expected: %+v", completed)
+	}
+	f, err := backend.Open(completed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if b, _ := ioutil.ReadAll(f); string(b) != "hello world" {
+		t.Errorf(`uploaded content was %q, expected "hello world"`, b)
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	a := app.New("tus_version", app.Mode("Testing", true), tus.Config("/files", tus.Options{}))
+	if err := a.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	rw := tusRequest(t, a, "POST", "/files", "", "Tus-Resumable", "0.2.2", "Upload-Length", "1")
+	if rw.Code != http.StatusPreconditionFailed {
+		t.Errorf("unsupported version status was %d, expected 412", rw.Code)
+	}
+}
+
+// staleBackend is a FileBackend reporting uploads at offset 0, as another
+// request writes to the upload between reading its Info and writing.
+type staleBackend struct {
+	*tus.FileBackend
+}
+
+func (b staleBackend) Info(id string) (tus.Info, error) {
+	i, err := b.FileBackend.Info(id)
+	i.Offset = 0
+	return i, err
+}
+
+func TestConcurrentPatch(t *testing.T) {
+	backend, err := tus.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := app.New("tus_concurrent", app.Mode("Testing", true), tus.Config("/files", tus.Options{Backend: staleBackend{backend}}))
+	if err := a.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	location := tusRequest(t, a, "POST", "/files", "", "Upload-Length", "11").Header().Get("Location")
+	tusRequest(t, a, "PATCH", location, "hello ", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0")
+	rw := tusRequest(t, a, "PATCH", location, "world", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0")
+	if rw.Code != http.StatusConflict {
+		t.Errorf("patch at an offset written concurrently was %d, expected 409", rw.Code)
+	}
+}
+
+func TestExpiredWrite(t *testing.T) {
+	backend, err := tus.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := backend.Create(tus.Info{Size: 5, Expires: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Write(i.ID, 0, strings.NewReader("hello")); !errors.Is(err, tus.ErrNotFound) {
+		t.Errorf("write to an expired upload returned %v, expected ErrNotFound", err)
+	}
+}
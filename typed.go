@@ -0,0 +1,120 @@
+package app
+
+import (
+	"reflect"
+
+	"github.com/flxtilla/cxre/extension"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/store"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// functionsOf returns the value of each function in the provided
+// extension.Extension, keyed by function name.
+func functionsOf(x extension.Extension) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for _, fn := range x.Functions() {
+		ret[fn.Name()] = fn.Fn()
+	}
+	return ret
+}
+
+var (
+	noTypedFunction  = xrr.NewXrror("no extension function named %s").Out
+	mistypedFunction = xrr.NewXrror("extension function %s is %s, not %s").Out
+)
+
+// A Resolver is any item resolved against an App during configuration.
+type Resolver interface {
+	Resolve(*App) error
+}
+
+// TypedFunction is a type safe accessor for a named extension function,
+// resolved and type checked once against an App.
+type TypedFunction[F any] struct {
+	name string
+	fn   F
+}
+
+// Typed returns a TypedFunction for the extension function with the provided
+// name, where F is the exact function type of the extension function, e.g.
+//
+//	var modeIs = app.Typed[func(state.State, string) bool]("mode_is")
+//
+// The TypedFunction must be resolved, usually with the Resolve Config, before
+// use.
+func Typed[F any](name string) *TypedFunction[F] {
+	return &TypedFunction[F]{name: name}
+}
+
+// Name returns the name of the extension function.
+func (t *TypedFunction[F]) Name() string {
+	return t.name
+}
+
+// Resolve finds the extension function in the provided App, returning an
+// error if the function does not exist or is not of type F.
+func (t *TypedFunction[F]) Resolve(a *App) error {
+	v, ok := functionsOf(a.Environment)[t.name]
+	if !ok {
+		return noTypedFunction(t.name)
+	}
+	fn, ok := v.(F)
+	if !ok {
+		return mistypedFunction(t.name, reflect.TypeOf(v), reflect.TypeOf((*F)(nil)).Elem())
+	}
+	t.fn = fn
+	return nil
+}
+
+// Fn returns the resolved extension function, or the zero value of F (a nil
+// function) if the TypedFunction has not been resolved.
+func (t *TypedFunction[F]) Fn() F {
+	return t.fn
+}
+
+// Resolve returns a Config resolving the provided Resolvers against the App,
+// after all built in extension functions have been added. Any unresolvable
+// item is a configuration error.
+func Resolve(rs ...Resolver) Config {
+	return NewConfig(1100, func(a *App) error {
+		for _, r := range rs {
+			if err := r.Resolve(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type builtInTypes []func(*App) error
+
+func (b builtInTypes) Resolve(a *App) error {
+	for _, fn := range b {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuiltIns is a Resolver type checking the built in extension functions used
+// by the package accessors, e.g. Stored, ModeIs, and Files, against those of
+// an App, as done when configuring every App.
+var BuiltIns Resolver = builtInTypes{
+	func(a *App) error { return Typed[func(state.State) store.Store]("store").Resolve(a) },
+	func(a *App) error { return Typed[func(state.State, string) bool]("mode_is").Resolve(a) },
+	func(a *App) error { return Typed[func(state.State) (RequestFiles, error)]("files").Resolve(a) },
+}
+
+func cBuiltInTypes(a *App) error {
+	return BuiltIns.Resolve(a)
+}
+
+// mistyped reports an extension function result of an unexpected type, e.g.
+// from a function replaced after configuration, to the request Logger.
+func mistyped(s state.State, name string, v interface{}, expected string) {
+	if l := Logger(s); l != nil {
+		l.Errorf("extension function %s returned %T, expected %s", name, v, expected)
+	}
+}
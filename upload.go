@@ -0,0 +1,220 @@
+package app
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/cxre/xrr"
+)
+
+// RequestFiles is a map keyed to string containing values of array of
+// mulitpart.FileHeader.
+type RequestFiles map[string][]*multipart.FileHeader
+
+var (
+	uploadTooLarge   = xrr.NewXrror("upload exceeds the upload_size of %d bytes").Out
+	noUploadedFile   = xrr.NewXrror("no uploaded file for field %s").Out
+	disallowedUpload = xrr.NewXrror("uploaded file %s has disallowed content type %s").Out
+)
+
+// tooLarge returns a 413 Problem for an upload exceeding the limit, responded
+// with when passed to Abort.
+func tooLarge(limit int64) error {
+	return NewProblem(http.StatusRequestEntityTooLarge, uploadTooLarge(limit).Error())
+}
+
+// uploads parses, once per request, any multipart form of the request. The
+// request body is limited to the "upload_size" Store value, with file parts
+// exceeding the "upload_memory" Store value streamed to temporary files
+// removed when the request is finished. Requests not served by the App, with
+// no finish to remove temporary files, are parsed in memory.
+func uploads(a *App, s state.State) (*multipart.Form, error) {
+	rq := s.Request()
+	r := requestOf(rq)
+	if r == nil {
+		return parseUploads(a, s.RWriter(), rq, false)
+	}
+	r.uploadOnce.Do(func() {
+		r.uploads, r.uploadErr = parseUploads(a, s.RWriter(), rq, true)
+		if r.uploads != nil {
+			r.atFinish(func() { r.uploads.RemoveAll() })
+		}
+	})
+	return r.uploads, r.uploadErr
+}
+
+func storedSize(a *App, key string, def int64) int64 {
+	if v, err := strconv.ParseInt(a.String(key), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func parseUploads(a *App, rw http.ResponseWriter, rq *http.Request, tracked bool) (*multipart.Form, error) {
+	if !strings.HasPrefix(rq.Header.Get("Content-Type"), "multipart/") {
+		return nil, nil
+	}
+	if rq.MultipartForm != nil {
+		return rq.MultipartForm, nil
+	}
+	limit := storedSize(a, "upload_size", 10000000)
+	if rq.ContentLength > limit {
+		return nil, tooLarge(limit)
+	}
+	memory := limit
+	if tracked {
+		memory = storedSize(a, "upload_memory", 1<<20)
+	}
+	rq.Body = http.MaxBytesReader(rw, rq.Body, limit)
+	if err := rq.ParseMultipartForm(memory); err != nil {
+		if rq.MultipartForm != nil {
+			rq.MultipartForm.RemoveAll()
+		}
+		if _, ok := err.(*http.MaxBytesError); ok {
+			return nil, tooLarge(limit)
+		}
+		return nil, err
+	}
+	return rq.MultipartForm, nil
+}
+
+// Files extracts uploaded files from http.Request, specifically though
+// request.MultipartForm.File. A request with an upload failing to parse is
+// aborted, with the 413 Problem for an upload exceeding "upload_size", or else
+// with a 400.
+func Files(s state.State) RequestFiles {
+	f, err := Dispatch(s, "files")
+	if err != nil {
+		if _, ok := problemOf(err); ok {
+			Abort(s, 0, err)
+		} else {
+			Abort(s, http.StatusBadRequest, err)
+		}
+		return nil
+	}
+	if files, ok := f.(RequestFiles); ok {
+		return files
+	}
+	mistyped(s, "files", f, "RequestFiles")
+	return nil
+}
+
+func filesFunc(a *App) func(state.State) (RequestFiles, error) {
+	return func(s state.State) (RequestFiles, error) {
+		form, err := uploads(a, s)
+		if err != nil || form == nil {
+			return nil, err
+		}
+		return form.File, nil
+	}
+}
+
+// allowedType reports whether the content type is allowed by the comma
+// separated "upload_allowed_types" Store value, with e.g. "image/*" allowing
+// any image type. All types are allowed when the value is empty.
+func allowedType(a *App, ct string) bool {
+	allowed := a.String("upload_allowed_types")
+	if allowed == "" {
+		return true
+	}
+	ct = strings.TrimSpace(strings.SplitN(ct, ";", 2)[0])
+	for _, t := range strings.Split(allowed, ",") {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == ct, t == "*/*":
+			return true
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(t, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// openUpload opens the first uploaded file for field, sniffing its content
+// type against the allowed upload types.
+func openUpload(a *App, s state.State, field string) (multipart.File, error) {
+	form, err := uploads(a, s)
+	if err != nil {
+		return nil, err
+	}
+	if form == nil || len(form.File[field]) == 0 {
+		return nil, noUploadedFile(field)
+	}
+	fh := form.File[field][0]
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	if ct := http.DetectContentType(sniff[:n]); !allowedType(a, ct) {
+		f.Close()
+		return nil, disallowedUpload(fh.Filename, ct)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func openFileFunc(a *App) func(state.State, string) (multipart.File, error) {
+	return func(s state.State, field string) (multipart.File, error) {
+		return openUpload(a, s, field)
+	}
+}
+
+func saveFileFunc(a *App) func(state.State, string, string) error {
+	return func(s state.State, field, path string) error {
+		f, err := openUpload(a, s, field)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(out, f); err != nil {
+			out.Close()
+			os.Remove(path)
+			return err
+		}
+		return out.Close()
+	}
+}
+
+// Provided a State and a form field name, OpenFile opens the first file
+// uploaded for the field, if its sniffed content type is allowed by the
+// "upload_allowed_types" Store value.
+func OpenFile(s state.State, field string) (multipart.File, error) {
+	f, err := Dispatch(s, "open_file", field)
+	if err != nil {
+		return nil, err
+	}
+	if ret, ok := f.(multipart.File); ok {
+		return ret, nil
+	}
+	return nil, noUploadedFile(field)
+}
+
+// Provided a State, a form field name, and a path, SaveFile saves the first
+// file uploaded for the field to the path, if its sniffed content type is
+// allowed by the "upload_allowed_types" Store value.
+func SaveFile(s state.State, field, path string) error {
+	_, err := Dispatch(s, "save_file", field, path)
+	return err
+}
@@ -0,0 +1,113 @@
+package app_test
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flxtilla/app"
+	"github.com/flxtilla/cxre/state"
+	"github.com/flxtilla/txst"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// upload returns the content type and body of a multipart form uploading the
+// content as a file for the field.
+func upload(t *testing.T, field, filename string, content []byte) (string, []byte) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	fw, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	w.Close()
+	return w.FormDataContentType(), b.Bytes()
+}
+
+func TestUploadSize(t *testing.T) {
+	a := txst.TxstingApp(t, "upload_size",
+		app.Store("upload_size:512"),
+		app.Problems("/", true),
+	)
+	aborting := func(s state.State) {
+		if err := app.SaveFile(s, "file", filepath.Join(t.TempDir(), "saved")); err != nil {
+			app.Abort(s, 0, err)
+		}
+	}
+	small, smallBody := upload(t, "file", "small.txt", []byte("small"))
+	large, largeBody := upload(t, "file", "large.txt", bytes.Repeat([]byte("large"), 200))
+	txst.MultiPerformer(t, a,
+		expect(200, "POST", "/small", aborting).sending(small, smallBody),
+		expect(413, "POST", "/large", aborting).sending(large, largeBody),
+	).Perform()
+}
+
+func TestFilesTooLarge(t *testing.T) {
+	a := txst.TxstingApp(t, "files_too_large",
+		app.Store("upload_size:512"),
+		app.Problems("/", true),
+	)
+	files := func(s state.State) {
+		if f := app.Files(s); f != nil {
+			s.RWriter().WriteHeader(200)
+		}
+	}
+	small, smallBody := upload(t, "file", "small.txt", []byte("small"))
+	large, largeBody := upload(t, "file", "large.txt", bytes.Repeat([]byte("large"), 200))
+	txst.MultiPerformer(t, a,
+		expect(200, "POST", "/small", files).sending(small, smallBody),
+		expect(413, "POST", "/large", files).sending(large, largeBody),
+	).Perform()
+}
+
+func TestUploadAllowedTypes(t *testing.T) {
+	a := txst.TxstingApp(t, "upload_allowed_types",
+		app.Store("upload_allowed_types:image/*"),
+	)
+	opens := func(allowed bool) state.Manage {
+		return func(s state.State) {
+			f, err := app.OpenFile(s, "file")
+			if (err == nil) != allowed {
+				t.Errorf("%s opened with %v, expected allowed: %t", s.Request().URL.Path, err, allowed)
+			}
+			if f != nil {
+				f.Close()
+			}
+		}
+	}
+	png, pngBody := upload(t, "file", "named.txt", pngHeader)
+	text, textBody := upload(t, "file", "named.png", []byte("plain text"))
+	txst.MultiPerformer(t, a,
+		expect(200, "POST", "/image", opens(true)).sending(png, pngBody),
+		expect(200, "POST", "/text", opens(false)).sending(text, textBody),
+	).Perform()
+}
+
+func TestUploadCleanup(t *testing.T) {
+	a := txst.TxstingApp(t, "upload_cleanup", app.Store("upload_memory:16"))
+	var temp string
+	ct, body := upload(t, "file", "streamed.txt", bytes.Repeat([]byte("streamed"), 64))
+	x := expect(200, "POST", "/streamed", func(s state.State) {
+		f, err := app.OpenFile(s, "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		of, ok := f.(*os.File)
+		if !ok {
+			t.Fatalf("expected a file part beyond upload_memory in a temporary file, got %T", f)
+		}
+		temp = of.Name()
+	}).sending(ct, body).check(func(t *testing.T, _ *httptest.ResponseRecorder) {
+		if _, err := os.Stat(temp); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("temporary file %s remained after the request: %v", temp, err)
+		}
+	})
+	txst.SimplePerformer(t, a, x).Perform()
+}